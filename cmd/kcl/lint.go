@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/properties"
+)
+
+// lint reports the issues of every properties file in args, one per
+// line as file:line: message. It returns 1 if any file has errors, or
+// warnings with -strict.
+func lint(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	strict := fs.Bool("strict", false, "fail on warnings too")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: kcl lint [-strict] file.properties...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	code := 0
+	for _, path := range fs.Args() {
+		if !lintFile(os.Stdout, path, *strict) {
+			code = 1
+		}
+	}
+	return code
+}
+
+// lintFile writes the issues of path to w, and reports whether it
+// passed.
+func lintFile(w io.Writer, path string, strict bool) bool {
+	p, err := properties.Load(path)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return false
+	}
+	_, issues := properties.Lint(p)
+	ok := true
+	for _, issue := range issues {
+		if issue.Severity == properties.Error || strict {
+			ok = false
+		}
+		line := issue.Line
+		issue.Line = 0
+		if line > 0 {
+			fmt.Fprintf(w, "%s:%d: %s\n", path, line, issue)
+		} else {
+			fmt.Fprintf(w, "%s: %s\n", path, issue)
+		}
+	}
+	return ok
+}
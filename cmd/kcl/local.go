@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/daemon"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/launcher"
+)
+
+// local runs the processor of a properties file like the MultiLangDaemon
+// does, without Java or AWS, feeding it records from a file or generated
+// ones and checkpointing to a local file.
+func local(args []string) int {
+	fs := flag.NewFlagSet("local", flag.ExitOnError)
+	recordsPath := fs.String("records", "", "file to read records from, instead of generating them")
+	format := fs.String("format", string(daemon.FormatLines), "format of the records file, lines or records")
+	generate := fs.Int("generate", 100, "number of records to generate when there is no records file")
+	shards := fs.Int("shards", 1, "number of shards the stream starts with")
+	batchSize := fs.Int("batch-size", 0, "records per processRecords action, defaults to maxRecords from the properties or 100")
+	reshardAfter := fs.Int("reshard-after", 0, "split every shard in two after this many records")
+	stealLeaseAfter := fs.Int("steal-lease-after", 0, "steal the lease of the first shard once after this many records")
+	checkpoints := fs.String("checkpoints", "", "checkpoint file, defaults to .localdaemon/<applicationName>-checkpoints.json")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: kcl local [flags] file.properties")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	loggr := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	// checked like `kcl run` checks it, warnings are logged
+	props, err := launcher.New(fs.Arg(0), launcher.WithLauncherLogger(loggr)).Check()
+	if err != nil {
+		loggr.Error("invalid properties file", "error", err)
+		return 1
+	}
+	position := daemon.TrimHorizon
+	if props.InitialPositionInStream != "" {
+		position = props.InitialPositionInStream
+	}
+	if *batchSize == 0 {
+		*batchSize = 100
+		if props.MaxRecords != nil {
+			*batchSize = *props.MaxRecords
+		}
+	}
+	if *checkpoints == "" {
+		*checkpoints = filepath.Join(".localdaemon", props.ApplicationName+"-checkpoints.json")
+	}
+
+	records, err := loadRecords(*recordsPath, daemon.Format(*format), *generate)
+	if err != nil {
+		loggr.Error("error reading records", "error", err)
+		return 1
+	}
+	store, err := daemon.OpenStore(*checkpoints)
+	if err != nil {
+		loggr.Error("error opening checkpoint file", "error", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		loggr.Info("shutting down, signal again to exit immediately")
+		cancel()
+		<-sigs
+		os.Exit(1)
+	}()
+
+	loggr.Info("starting local daemon",
+		"executable", props.ExecutableName,
+		"records", len(records),
+		"shards", *shards,
+		"checkpoints", *checkpoints,
+	)
+	err = daemon.NewLocal(props.ExecutableName, records, store,
+		daemon.WithShards(*shards),
+		daemon.WithBatchSize(*batchSize),
+		daemon.WithReshardAfter(*reshardAfter),
+		daemon.WithLeaseStealAfter(*stealLeaseAfter),
+		daemon.WithInitialPosition(position),
+		daemon.WithStderr(os.Stderr),
+		daemon.WithLocalLogger(loggr),
+	).Run(ctx)
+	if err != nil {
+		loggr.Error("local daemon failed", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// loadRecords reads the records at path, or generates n records if
+// path is empty.
+func loadRecords(path string, format daemon.Format, n int) ([]actions.Record, error) {
+	if path == "" {
+		return daemon.GenerateRecords(n), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return daemon.ReadRecords(f, format)
+}
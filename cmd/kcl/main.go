@@ -0,0 +1,58 @@
+// Command kcl holds tools for working with KCL MultiLangDaemon
+// applications:
+//
+//	kcl lint [-strict] file.properties...
+//
+// checks properties files for mistakes the KCL would otherwise only
+// report after starting up, and
+//
+//	kcl run [flags] file.properties
+//
+// checks one and starts the MultiLangDaemon for it,
+//
+//	kcl local [flags] file.properties
+//
+// runs its processor end to end without Java or AWS, and
+//
+//	kcl replay [flags] records-file
+//
+// feeds archived records to a processor without the KCL.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: kcl <command> [arguments]
+
+commands:
+  lint    check KCL properties files
+  run     start the MultiLangDaemon for a properties file
+  local   run the processor of a properties file without Java or AWS
+  replay  feed archived records to a processor
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var code int
+	switch os.Args[1] {
+	case "lint":
+		code = lint(os.Args[2:])
+	case "run":
+		code = run(os.Args[2:])
+	case "local":
+		code = local(os.Args[2:])
+	case "replay":
+		code = replay(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "kcl: unknown command %q\n\n%s", os.Args[1], usage)
+		code = 2
+	}
+	os.Exit(code)
+}
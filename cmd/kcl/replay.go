@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/daemon"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/properties"
+)
+
+// replay feeds a file of archived records to a processor, reporting
+// its throughput and the batch it failed on, if any.
+func replay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	command := fs.String("exec", "", "processor command line, instead of executableName from -properties")
+	propsPath := fs.String("properties", "", "KCL properties file naming the processor")
+	format := fs.String("format", string(daemon.FormatRecords), "format of the records file, records (NDJSON of actions.Record) or lines (one payload per line)")
+	batchSize := fs.Int("batch-size", 100, "records per processRecords action")
+	shardId := fs.String("shard-id", "shardId-000000000000", "shard the processor is told it reads")
+	progress := fs.String("progress", "", "file checkpoints are saved to, defaults to <records file>.progress.json")
+	shardEnd := fs.Bool("shard-end", false, "end the shard after the last record instead of shutting down")
+	reportEvery := fs.Duration("report-every", 10*time.Second, "how often to log progress")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: kcl replay [flags] records-file")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || (*command == "") == (*propsPath == "") {
+		fs.Usage()
+		return 2
+	}
+	loggr := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	if *propsPath != "" {
+		c, err := properties.LoadConfig(*propsPath)
+		if err != nil {
+			loggr.Error("invalid properties file", "error", err)
+			return 1
+		}
+		*command = c.ExecutableName
+	}
+	path := fs.Arg(0)
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			loggr.Error("error opening records", "error", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+	if *progress == "" {
+		if path == "-" {
+			loggr.Error("-progress must be set when reading records from stdin")
+			return 2
+		}
+		*progress = path + ".progress.json"
+	}
+	records, err := daemon.NewRecordReader(in, daemon.Format(*format))
+	if err != nil {
+		loggr.Error("error reading records", "error", err)
+		return 2
+	}
+	store, err := daemon.OpenStore(*progress)
+	if err != nil {
+		loggr.Error("error opening progress file", "error", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		loggr.Info("stopping replay, signal again to exit immediately")
+		cancel()
+		<-sigs
+		os.Exit(1)
+	}()
+
+	loggr.Info("replaying records", "records", path, "processor", *command, "progress", *progress)
+	stats, err := daemon.NewReplay(*command, records, store,
+		daemon.WithReplayShardId(*shardId),
+		daemon.WithReplayBatchSize(*batchSize),
+		daemon.WithReplayShardEnd(*shardEnd),
+		daemon.WithReplayReportEvery(*reportEvery),
+		daemon.WithReplayStderr(os.Stderr),
+		daemon.WithReplayLogger(loggr),
+	).Run(ctx)
+	if err != nil {
+		loggr.Error("replay failed, run again to resume after the last checkpoint", "stats", stats, "error", err)
+		return 1
+	}
+	loggr.Info("replay finished", "stats", stats)
+	return 0
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/launcher"
+)
+
+// run starts the MultiLangDaemon for a properties file, exiting with
+// the daemon's status.
+func run(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	jars := fs.String("jars", "jars", "directory holding the KCL jars")
+	java := fs.String("java", "", "java executable, defaults to $JAVA_HOME/bin/java or java from the PATH")
+	javaOpts := fs.String("java-opts", "", "space separated JVM options, e.g. -Xmx512m")
+	logback := fs.String("logback", "", "logback config file, defaults to ./logback.xml if there is one")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: kcl run [flags] file.properties")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	loggr := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	opts := []launcher.LauncherOpts{
+		launcher.WithJarsDir(*jars),
+		launcher.WithJava(*java),
+		launcher.WithJavaArgs(strings.Fields(*javaOpts)...),
+		launcher.WithLauncherLogger(loggr),
+	}
+	if *logback != "" {
+		opts = append(opts, launcher.WithLogbackConfig(*logback))
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	err := launcher.New(fs.Arg(0), opts...).Run(context.Background(), signals)
+	var exitErr *launcher.ExitError
+	if errors.As(err, &exitErr) && exitErr.Code > 0 {
+		loggr.Error("multilang daemon failed", "error", err)
+		return exitErr.Code
+	}
+	if err != nil {
+		loggr.Error("multilang daemon failed", "error", err)
+		return 1
+	}
+	return 0
+}
@@ -29,6 +29,12 @@ func (rp *SimpleRecordProcessor) Initialize(shardId, seqNum string, subSeqNum in
 	return nil
 }
 
+// SetLogger swaps in the manager's logger, which tags every line with
+// the shard ID, worker PID and current action.
+func (rp *SimpleRecordProcessor) SetLogger(l *slog.Logger) {
+	rp.Loggr = l
+}
+
 func (rp *SimpleRecordProcessor) ProcessRecords(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
 	rp.Loggr.Info("got records to process", "amount", len(records), "lag_in_ms", lag)
 	for _, r := range records {
@@ -82,5 +88,9 @@ func main() {
 		kcl.WithManagerLogger(loggr),
 	)
 
-	kcl.Run()
+	err := kcl.Start()
+	if err != nil {
+		loggr.Error("record processor stopped", "error", err)
+		os.Exit(1)
+	}
 }
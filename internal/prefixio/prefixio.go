@@ -0,0 +1,60 @@
+// Package prefixio prefixes every line written through it, to tell the
+// output of several child processes apart.
+package prefixio
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Writer prefixes every line written to it. Writers sharing w should
+// share mu so their lines do not interleave.
+type Writer struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+// NewWriter creates a Writer writing to w, locking mu around every line
+// written.
+func NewWriter(w io.Writer, mu *sync.Mutex, prefix string) *Writer {
+	return &Writer{mu: mu, w: w, prefix: prefix}
+}
+
+func (p *Writer) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		err := p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+		if err != nil {
+			return len(b), err
+		}
+	}
+}
+
+// Flush writes out a last line without a newline.
+func (p *Writer) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *Writer) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := io.WriteString(p.w, p.prefix)
+	if err != nil {
+		return err
+	}
+	_, err = p.w.Write(line)
+	return err
+}
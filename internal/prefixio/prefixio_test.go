@@ -0,0 +1,26 @@
+package prefixio
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	t.Run("prefixes lines split across writes", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		var mu sync.Mutex
+		a := NewWriter(out, &mu, "[a] ")
+		b := NewWriter(out, &mu, "[b] ")
+
+		a.Write([]byte("one\ntw"))
+		b.Write([]byte("three\n"))
+		a.Write([]byte("o\nfour"))
+		assert.Equal(t, "[a] one\n[b] three\n[a] two\n", out.String())
+		assert.NoError(t, a.Flush())
+		assert.NoError(t, b.Flush())
+		assert.Equal(t, "[a] one\n[b] three\n[a] two\n[a] four\n", out.String())
+	})
+}
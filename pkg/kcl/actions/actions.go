@@ -2,6 +2,7 @@ package actions
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 )
 
@@ -13,9 +14,42 @@ const (
 	SHUTDOWN_REQUESTED = "shutdownRequested"
 )
 
+// ErrMissingActionType is wrapped by the DecodeError returned for a
+// message without an "action" field.
+var ErrMissingActionType = errors.New("message has no action type")
+
+// DecodeError is returned when a message from the KCL Multilang process
+// is not a valid action, or is converted to the wrong action type.
+type DecodeError struct {
+	// Action is the action type of the message, empty if it has none
+	Action string
+	// Target is the action it was converted to, empty when decoding
+	// a RawAction
+	Target string
+	// Err is why decoding failed, nil if the action type did not match
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	switch {
+	case e.Target == "":
+		return fmt.Sprintf("error decoding kcl action: %v", e.Err)
+	case e.Err == nil:
+		return fmt.Sprintf("raw action type <%s> cannot be converted to %s", e.Action, e.Target)
+	default:
+		return fmt.Sprintf("error decoding %s action as %s: %v", e.Action, e.Target, e.Err)
+	}
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
 type RawAction struct {
 	ActionType string `json:"action"`
-	Raw        []byte
+	// Raw is the whole message, kept to decode it into its concrete
+	// action type
+	Raw []byte `json:"-"`
 }
 
 func (a *RawAction) UnmarshalJSON(data []byte) error {
@@ -23,10 +57,14 @@ func (a *RawAction) UnmarshalJSON(data []byte) error {
 	var tmp Alias
 	err := json.Unmarshal(data, &tmp)
 	if err != nil {
-		return err
+		return &DecodeError{Err: err}
+	}
+	if tmp.ActionType == "" {
+		return &DecodeError{Err: ErrMissingActionType}
 	}
 	*a = RawAction(tmp)
-	a.Raw = data
+	// data belongs to the caller, e.g. a json.Decoder reusing its buffer
+	a.Raw = append([]byte(nil), data...)
 	return nil
 }
 
@@ -39,60 +77,43 @@ func NewRawAction(msg string) (RawAction, error) {
 	return rawAction, nil
 }
 
-func (ra *RawAction) ToInitAction() (InitAction, error) {
-	var a InitAction
-	if ra.ActionType != INITITALIZE {
-		return a, fmt.Errorf("raw action type <%s> cannot be converted to InitAction", ra.ActionType)
+// convert decodes the raw action into v, the concrete type target of
+// action type want.
+func (ra *RawAction) convert(want, target string, v any) error {
+	if ra.ActionType != want {
+		return &DecodeError{Action: ra.ActionType, Target: target}
 	}
-	err := json.Unmarshal(ra.Raw, &a)
+	err := json.Unmarshal(ra.Raw, v)
 	if err != nil {
-		return a, err
+		return &DecodeError{Action: ra.ActionType, Target: target, Err: err}
 	}
-	return a, nil
+	return nil
+}
+
+func (ra *RawAction) ToInitAction() (InitAction, error) {
+	var a InitAction
+	err := ra.convert(INITITALIZE, "InitAction", &a)
+	return a, err
 }
 func (ra *RawAction) ToProcessAction() (ProcessAction, error) {
 	var a ProcessAction
-	if ra.ActionType != PROCESS_RECORDS {
-		return a, fmt.Errorf("raw action type <%s> cannot be converted to ProcessAction", ra.ActionType)
-	}
-	err := json.Unmarshal(ra.Raw, &a)
-	if err != nil {
-		return a, err
-	}
-	return a, nil
+	err := ra.convert(PROCESS_RECORDS, "ProcessAction", &a)
+	return a, err
 }
 func (ra *RawAction) ToLeaseLostAction() (LeaseLostAction, error) {
 	var a LeaseLostAction
-	if ra.ActionType != LEASE_LOST {
-		return a, fmt.Errorf("raw action type <%s> cannot be converted to LeastLostAction", ra.ActionType)
-	}
-	err := json.Unmarshal(ra.Raw, &a)
-	if err != nil {
-		return a, err
-	}
-	return a, nil
+	err := ra.convert(LEASE_LOST, "LeaseLostAction", &a)
+	return a, err
 }
 func (ra *RawAction) ToShardEndedAction() (ShardEndedAction, error) {
 	var a ShardEndedAction
-	if ra.ActionType != SHARD_ENDED {
-		return a, fmt.Errorf("raw action type <%s> cannot be converted to ShardEndedAction", ra.ActionType)
-	}
-	err := json.Unmarshal(ra.Raw, &a)
-	if err != nil {
-		return a, err
-	}
-	return a, nil
+	err := ra.convert(SHARD_ENDED, "ShardEndedAction", &a)
+	return a, err
 }
 func (ra *RawAction) ToShutdownRequestedAction() (ShutdownRequestedAction, error) {
 	var a ShutdownRequestedAction
-	if ra.ActionType != SHUTDOWN_REQUESTED {
-		return a, fmt.Errorf("raw action type <%s> cannot be converted to ShutDownRequestedAction", ra.ActionType)
-	}
-	err := json.Unmarshal(ra.Raw, &a)
-	if err != nil {
-		return a, err
-	}
-	return a, nil
+	err := ra.convert(SHUTDOWN_REQUESTED, "ShutdownRequestedAction", &a)
+	return a, err
 }
 
 type InitAction struct {
@@ -0,0 +1,111 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// seeds are messages as the KCL Multilang process sends them.
+var seeds = []string{
+	`{"action":"initialize","shardId":"shardId-000000000000","sequenceNumber":"TRIM_HORIZON","subSequenceNumber":0}`,
+	`{"action":"processRecords","millisBehindLatest":1000,"records":[{"action":"record","data":"aGVsbG8=","partitionKey":"pk","approximateArrivalTimestamp":1704067200000,"sequenceNumber":"49590338271490256608561711338831091224701278195820789858","subSequenceNumber":0}]}`,
+	`{"action":"processRecords","millisBehindLatest":0,"records":[]}`,
+	`{"action":"leaseLost"}`,
+	`{"action":"shardEnded"}`,
+	`{"action":"shutdownRequested"}`,
+	`{"action":"checkpoint","sequenceNumber":null,"subSequenceNumber":null,"error":""}`,
+}
+
+func FuzzRawActionUnmarshalJSON(f *testing.F) {
+	for _, s := range seeds {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		orig := bytes.Clone(data)
+		var ra RawAction
+		err := ra.UnmarshalJSON(data)
+		if err != nil {
+			var decErr *DecodeError
+			assert.ErrorAs(t, err, &decErr)
+			return
+		}
+		assert.NotEmpty(t, ra.ActionType)
+		assert.Equal(t, orig, ra.Raw)
+		// Raw must not alias the caller's buffer
+		for i := range data {
+			data[i] = 0
+		}
+		assert.Equal(t, orig, ra.Raw)
+	})
+}
+
+// converters converts a RawAction to each concrete action type, keyed
+// by the action type it accepts.
+var converters = map[string]func(ra *RawAction) (any, error){
+	INITITALIZE:        func(ra *RawAction) (any, error) { return ra.ToInitAction() },
+	PROCESS_RECORDS:    func(ra *RawAction) (any, error) { return ra.ToProcessAction() },
+	LEASE_LOST:         func(ra *RawAction) (any, error) { return ra.ToLeaseLostAction() },
+	SHARD_ENDED:        func(ra *RawAction) (any, error) { return ra.ToShardEndedAction() },
+	SHUTDOWN_REQUESTED: func(ra *RawAction) (any, error) { return ra.ToShutdownRequestedAction() },
+}
+
+func FuzzConvertAction(f *testing.F) {
+	for _, s := range seeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, msg string) {
+		ra, err := NewRawAction(msg)
+		if err != nil {
+			return
+		}
+		for actionType, convert := range converters {
+			a, err := convert(&ra)
+			if err != nil {
+				var decErr *DecodeError
+				if assert.ErrorAs(t, err, &decErr) {
+					assert.Equal(t, ra.ActionType, decErr.Action)
+				}
+				continue
+			}
+			assert.Equal(t, actionType, ra.ActionType)
+
+			// a valid action survives being sent again unchanged
+			b, err := json.Marshal(a)
+			assert.NoError(t, err)
+			again, err := NewRawAction(string(b))
+			if !assert.NoError(t, err) {
+				continue
+			}
+			assert.Equal(t, ra.ActionType, again.ActionType)
+			b2, err := convert(&again)
+			assert.NoError(t, err)
+			assert.Equal(t, a, b2)
+		}
+	})
+}
+
+func TestDecodeError(t *testing.T) {
+	t.Run("rejects message without action type", func(t *testing.T) {
+		_, err := NewRawAction(`{"shardId":"shardId-000"}`)
+		assert.ErrorIs(t, err, ErrMissingActionType)
+	})
+
+	t.Run("reports wrong action type", func(t *testing.T) {
+		ra, err := NewRawAction(`{"action":"leaseLost"}`)
+		assert.NoError(t, err)
+		_, err = ra.ToInitAction()
+		assert.EqualError(t, err, "raw action type <leaseLost> cannot be converted to InitAction")
+	})
+
+	t.Run("wraps decoding errors", func(t *testing.T) {
+		ra, err := NewRawAction(`{"action":"processRecords","records":{}}`)
+		assert.NoError(t, err)
+		_, err = ra.ToProcessAction()
+		var typeErr *json.UnmarshalTypeError
+		assert.True(t, errors.As(err, &typeErr))
+	})
+}
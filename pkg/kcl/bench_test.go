@@ -0,0 +1,212 @@
+package kcl
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/daemon"
+)
+
+// The benchmarks measure the protocol path a batch takes through a
+// Manager: decoding the action, dispatching it to the processor,
+// checkpointing and acking. They run over every combination of batch
+// and payload size, so results compared with benchstat show which part
+// of the path a change moved. Run them with
+//
+//	go test ./pkg/kcl -run '^$' -bench . -benchmem -count 10
+var (
+	benchBatchSizes   = []int{1, 100, 1000}
+	benchPayloadSizes = []int{64, 1024, 16 << 10}
+)
+
+// benchCases runs fn as a sub benchmark for every batch and payload
+// size.
+func benchCases(b *testing.B, fn func(b *testing.B, batch actions.ProcessAction)) {
+	for _, n := range benchBatchSizes {
+		for _, size := range benchPayloadSizes {
+			b.Run(fmt.Sprintf("records=%d/payload=%d", n, size), func(b *testing.B) {
+				fn(b, benchBatch(n, size))
+			})
+		}
+	}
+}
+
+// benchBatch creates a processRecords action of n records with payloads
+// of size bytes before base64 encoding.
+func benchBatch(n, size int) actions.ProcessAction {
+	data := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", size)))
+	records := make([]actions.Record, n)
+	for i := range records {
+		records[i] = actions.Record{
+			Action:                      "record",
+			Data:                        data,
+			PartitionKey:                fmt.Sprintf("partitionKey-%d", i),
+			ApproximateArrivalTimestamp: 1700000000000,
+			SequenceNumber:              daemon.SequenceNumber(i + 1),
+		}
+	}
+	return actions.ProcessAction{Action: actions.PROCESS_RECORDS, Records: records}
+}
+
+func benchLine(b *testing.B, v any) []byte {
+	line, err := json.Marshal(v)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return append(line, '\n')
+}
+
+// repeatReader reads data over and over, like a KCL that never stops
+// sending the same message.
+type repeatReader struct {
+	data []byte
+	off  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := copy(p, r.data[r.off:])
+	r.off = (r.off + n) % len(r.data)
+	return n, nil
+}
+
+// reportRecords reports the records handled per second, the figure
+// throughput is usually talked about in.
+func reportRecords(b *testing.B, perOp int) {
+	b.ReportMetric(float64(perOp*b.N)/b.Elapsed().Seconds(), "records/s")
+}
+
+var quietLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// checkpointingProcessor checkpoints every batch, like most processors
+// do.
+func checkpointingProcessor() *RecordProcessorFuncs {
+	return &RecordProcessorFuncs{
+		ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+			return cp.CheckpointBatch()
+		},
+	}
+}
+
+func BenchmarkReadActionRequest(b *testing.B) {
+	benchCases(b, func(b *testing.B, batch actions.ProcessAction) {
+		line := benchLine(b, batch)
+		mli := NewMultilangInterface(&repeatReader{data: line}, io.Discard)
+		b.SetBytes(int64(len(line)))
+		b.ReportAllocs()
+		for b.Loop() {
+			_, err := mli.ReadActionRequest()
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		reportRecords(b, len(batch.Records))
+	})
+}
+
+func BenchmarkProcessRawAction(b *testing.B) {
+	ack := benchLine(b, map[string]any{"action": "checkpoint", "sequenceNumber": nil, "subSequenceNumber": nil})
+	benchCases(b, func(b *testing.B, batch actions.ProcessAction) {
+		var ra actions.RawAction
+		err := json.Unmarshal(benchLine(b, batch), &ra)
+		if err != nil {
+			b.Fatal(err)
+		}
+		kclm := NewManager(&repeatReader{data: ack}, io.Discard, checkpointingProcessor(), WithManagerLogger(quietLogger))
+		b.ReportAllocs()
+		for b.Loop() {
+			err := kclm.processRawAction(ra)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		reportRecords(b, len(batch.Records))
+	})
+}
+
+func BenchmarkWriteActionComplete(b *testing.B) {
+	mli := NewMultilangInterface(&repeatReader{data: []byte("\n")}, io.Discard)
+	b.ReportAllocs()
+	for b.Loop() {
+		err := mli.WriteActionComplete(actions.PROCESS_RECORDS)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCheckpoint(b *testing.B) {
+	seqNum := daemon.SequenceNumber(1)
+	cases := []struct {
+		name string
+		fn   func(cp *checkpoint.Checkpointer) error
+	}{
+		{"batch", func(cp *checkpoint.Checkpointer) error { return cp.CheckpointBatch() }},
+		{"seqnum", func(cp *checkpoint.Checkpointer) error { return cp.CheckpointSeqNum(seqNum) }},
+		{"subseqnum", func(cp *checkpoint.Checkpointer) error { return cp.CheckpointSubSeqNum(seqNum, 1) }},
+	}
+	ack := benchLine(b, map[string]any{"action": "checkpoint", "sequenceNumber": seqNum, "subSequenceNumber": 0})
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			cp := checkpoint.NewCheckpointer(&repeatReader{data: ack}, io.Discard)
+			b.ReportAllocs()
+			for b.Loop() {
+				err := c.fn(cp)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkManager sends batches to a Manager over pipes from an
+// in-memory daemon, which answers its checkpoints, so every operation
+// is a full processRecords round trip.
+func BenchmarkManager(b *testing.B) {
+	benchCases(b, func(b *testing.B, batch actions.ProcessAction) {
+		stdinR, stdinW, err := os.Pipe()
+		if err != nil {
+			b.Fatal(err)
+		}
+		stdoutR, stdoutW, err := os.Pipe()
+		if err != nil {
+			b.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			done <- NewManager(stdinR, stdoutW, checkpointingProcessor(), WithManagerLogger(quietLogger)).Start()
+			stdoutW.Close()
+		}()
+		defer func() {
+			stdinW.Close()
+			if err := <-done; err != nil {
+				b.Error(err)
+			}
+			stdinR.Close()
+			stdoutR.Close()
+		}()
+
+		conn := daemon.NewConn(stdoutR, stdinW, nil)
+		err = conn.Initialize("shardId-000000000000", daemon.TrimHorizon, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(benchLine(b, batch))))
+		b.ReportAllocs()
+		for b.Loop() {
+			err := conn.ProcessRecords(batch.Records, 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		reportRecords(b, len(batch.Records))
+	})
+}
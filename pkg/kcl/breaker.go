@@ -0,0 +1,209 @@
+package kcl
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBreakerShutdown is returned by CircuitBreaker.Do when the breaker
+// is open and has been released because the worker is shutting down.
+var ErrBreakerShutdown = errors.New("circuit breaker released for shutdown")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// CircuitBreaker guards calls to a downstream dependency from inside
+// `ProcessRecords`. After FailureThreshold consecutive failures the
+// breaker trips and Do blocks instead of returning, which holds the
+// processRecords acknowledgement so KCL sends no new records while the
+// dependency is down. Once the open timeout has elapsed the blocked call
+// is retried as a half-open probe: success closes the breaker, failure
+// opens it again.
+//
+// Register the breaker with Manager using WithCircuitBreaker so its
+// state is reported by Manager.Health and so it is released as soon as
+// the worker is asked to shut down.
+type CircuitBreaker struct {
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	// changed is closed and replaced every time the breaker changes
+	// state, waking up every call blocked in Do
+	changed  chan struct{}
+	shutdown bool
+}
+
+type CircuitBreakerOpts func(cb *CircuitBreaker)
+
+// NewCircuitBreaker creates a closed breaker that trips after 5
+// consecutive failures and probes every 30 seconds while open.
+func NewCircuitBreaker(opts ...CircuitBreakerOpts) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		failureThreshold: 5,
+		openTimeout:      30 * time.Second,
+		changed:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(cb)
+	}
+	return cb
+}
+
+// WithFailureThreshold sets how many consecutive failures trip the breaker.
+func WithFailureThreshold(n int) CircuitBreakerOpts {
+	return func(cb *CircuitBreaker) {
+		if n > 0 {
+			cb.failureThreshold = n
+		}
+	}
+}
+
+// WithOpenTimeout sets how long the breaker stays open before probing.
+func WithOpenTimeout(d time.Duration) CircuitBreakerOpts {
+	return func(cb *CircuitBreaker) {
+		cb.openTimeout = d
+	}
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// Do calls fn if the breaker is closed and returns its error. If fn
+// fails often enough to trip the breaker, or the breaker is already
+// open, Do blocks until a probe call of fn succeeds and then returns
+// nil. A blocked Do returns ErrBreakerShutdown once Shutdown is called.
+func (cb *CircuitBreaker) Do(fn func() error) error {
+	for {
+		wait, changed, probe, err := cb.acquire()
+		if err != nil {
+			return err
+		}
+		if changed != nil {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-changed:
+				timer.Stop()
+			}
+			continue
+		}
+
+		err = fn()
+		if cb.release(probe, err) {
+			// breaker is (still) open, block until the next probe
+			continue
+		}
+		return err
+	}
+}
+
+// acquire decides if the caller may run its call now, and if so whether
+// the call is the half-open probe. If not, it returns how long to wait
+// and a channel that is closed early if the breaker changes state in the
+// meantime.
+func (cb *CircuitBreaker) acquire() (time.Duration, <-chan struct{}, bool, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case BreakerOpen:
+		if cb.shutdown {
+			return 0, nil, false, ErrBreakerShutdown
+		}
+		remaining := cb.openTimeout - time.Since(cb.openedAt)
+		if remaining > 0 {
+			return remaining, cb.changed, false, nil
+		}
+		cb.setState(BreakerHalfOpen)
+		cb.probing = true
+		return 0, nil, true, nil
+	case BreakerHalfOpen:
+		if cb.shutdown {
+			return 0, nil, false, ErrBreakerShutdown
+		}
+		if cb.probing {
+			return cb.openTimeout, cb.changed, false, nil
+		}
+		cb.probing = true
+		return 0, nil, true, nil
+	default:
+		return 0, nil, false, nil
+	}
+}
+
+// release records the outcome of a call and reports whether the caller
+// should block because the breaker is open.
+func (cb *CircuitBreaker) release(probe bool, err error) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if probe {
+		cb.probing = false
+	}
+	if err == nil {
+		cb.failures = 0
+		if cb.state != BreakerClosed {
+			cb.setState(BreakerClosed)
+		}
+		return false
+	}
+
+	cb.failures++
+	if probe || cb.failures >= cb.failureThreshold {
+		cb.openedAt = time.Now()
+		cb.setState(BreakerOpen)
+		return true
+	}
+	return false
+}
+
+// setState must be called with cb.mu held.
+func (cb *CircuitBreaker) setState(s BreakerState) {
+	cb.state = s
+	close(cb.changed)
+	cb.changed = make(chan struct{})
+}
+
+// Shutdown releases every call blocked in Do and stops the breaker from
+// blocking in the future. Calls made while the breaker is closed still
+// go through so the processor can finish up and checkpoint.
+func (cb *CircuitBreaker) Shutdown() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.shutdown {
+		return
+	}
+	cb.shutdown = true
+	close(cb.changed)
+	cb.changed = make(chan struct{})
+}
@@ -0,0 +1,115 @@
+package kcl_test
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/kcltest"
+	"github.com/stretchr/testify/assert"
+)
+
+// The breaker tests are in package kcl_test so the manager can be
+// driven by kcltest.Daemon, which imports kcl.
+
+func TestCircuitBreaker(t *testing.T) {
+	downstreamErr := errors.New("downstream down")
+
+	t.Run("returns failures below threshold", func(t *testing.T) {
+		cb := kcl.NewCircuitBreaker(kcl.WithFailureThreshold(3))
+
+		err := cb.Do(func() error { return downstreamErr })
+		assert.ErrorIs(t, err, downstreamErr)
+		assert.Equal(t, kcl.BreakerClosed, cb.State())
+	})
+
+	t.Run("blocks when tripped until probe succeeds", func(t *testing.T) {
+		cb := kcl.NewCircuitBreaker(kcl.WithFailureThreshold(1), kcl.WithOpenTimeout(10*time.Millisecond))
+
+		calls := 0
+		err := cb.Do(func() error {
+			calls++
+			if calls < 3 {
+				return downstreamErr
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, kcl.BreakerClosed, cb.State())
+	})
+
+	t.Run("shutdown releases blocked call", func(t *testing.T) {
+		cb := kcl.NewCircuitBreaker(kcl.WithFailureThreshold(1), kcl.WithOpenTimeout(time.Hour))
+
+		done := make(chan error)
+		go func() {
+			done <- cb.Do(func() error { return downstreamErr })
+		}()
+		assert.Eventually(t, func() bool { return cb.State() == kcl.BreakerOpen }, time.Second, time.Millisecond)
+
+		cb.Shutdown()
+		select {
+		case err := <-done:
+			assert.ErrorIs(t, err, kcl.ErrBreakerShutdown)
+		case <-time.After(time.Second):
+			t.Fatal("blocked call was not released by shutdown")
+		}
+
+		// open breaker no longer blocks after shutdown
+		err := cb.Do(func() error { return nil })
+		assert.ErrorIs(t, err, kcl.ErrBreakerShutdown)
+	})
+}
+
+func TestManagerCircuitBreaker(t *testing.T) {
+	quiet := kcl.WithManagerLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	t.Run("reports breaker state in health", func(t *testing.T) {
+		cb := kcl.NewCircuitBreaker(kcl.WithFailureThreshold(1), kcl.WithOpenTimeout(time.Hour))
+		d := kcltest.NewDaemon(t, &kcl.RecordProcessorFuncs{}, kcltest.WithManagerOpts(quiet, kcl.WithCircuitBreaker("db", cb)))
+
+		assert.Equal(t, kcl.BreakerClosed, d.Manager().Health().CircuitBreakers["db"])
+		cb.Shutdown()
+		cb.Do(func() error { return errors.New("down") })
+		assert.Equal(t, kcl.BreakerOpen, d.Manager().Health().CircuitBreakers["db"])
+	})
+
+	t.Run("shutdown requested releases processor blocked on open breaker", func(t *testing.T) {
+		cb := kcl.NewCircuitBreaker(kcl.WithFailureThreshold(1), kcl.WithOpenTimeout(time.Hour))
+		var released error
+		rp := &kcl.RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				err := cb.Do(func() error { return errors.New("down") })
+				if errors.Is(err, kcl.ErrBreakerShutdown) {
+					released = err
+					return nil
+				}
+				return err
+			},
+		}
+		d := kcltest.NewDaemon(t, rp, kcltest.WithTimeout(2*time.Second), kcltest.WithManagerOpts(quiet, kcl.WithCircuitBreaker("db", cb)))
+		// runs before the daemon is closed, so a processor that was not
+		// released fails the test instead of hanging it
+		t.Cleanup(cb.Shutdown)
+
+		// the shutdown request is sent while the breaker holds the batch
+		d.Initialize("shardId-000").SendAll(
+			actions.ProcessAction{Action: actions.PROCESS_RECORDS, Records: []actions.Record{{SequenceNumber: "1"}}},
+			actions.ShutdownRequestedAction{Action: actions.SHUTDOWN_REQUESTED},
+		)
+
+		assert.ErrorIs(t, released, kcl.ErrBreakerShutdown)
+		assert.Equal(t, []string{actions.INITITALIZE, actions.PROCESS_RECORDS, actions.SHUTDOWN_REQUESTED}, d.Statuses())
+		cp, ok := d.LastCheckpoint()
+		if assert.True(t, ok, "processor checkpointed on shutdown") {
+			assert.Equal(t, "1", *cp.SeqNum)
+		}
+		assert.NoError(t, d.Close())
+	})
+}
@@ -2,78 +2,231 @@ package checkpoint
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/wiretap"
 )
 
+// checkPointResp is the ack KCL sends for a checkpoint. Its sub
+// sequence number is a json number (or null), not a string.
 type checkPointResp struct {
-	Action            string `json:"action"`
-	SequenceNumber    string `json:"sequenceNumber"`
-	SubSequenceNumber string `json:"subSequenceNumber"`
-	Error             string `json:"error"`
+	Action            string  `json:"action"`
+	SequenceNumber    *string `json:"sequenceNumber"`
+	SubSequenceNumber *int64  `json:"subSequenceNumber"`
+	Error             string  `json:"error"`
+}
+
+// AckError is returned when the KCL Multilang process responds to a
+// checkpoint with an error, e.g. "ThrottlingException" or
+// "ShutdownException".
+type AckError struct {
+	Err string
+}
+
+func (e *AckError) Error() string {
+	return fmt.Sprintf("bad checkpoint ack from kcl multilang process: %s", e.Err)
+}
+
+// InvalidAckError is returned when the KCL Multilang process answers a
+// checkpoint with something that is not a checkpoint ack.
+type InvalidAckError struct {
+	Err error
+}
+
+func (e *InvalidAckError) Error() string {
+	return fmt.Sprintf("invalid checkpoint ack from kcl multilang process: %v", e.Err)
+}
+
+func (e *InvalidAckError) Unwrap() error {
+	return e.Err
+}
+
+// Interface is what a record processor needs to checkpoint its
+// progress. Checkpointer is the implementation talking to the KCL
+// Multilang process. Code that only checkpoints should accept an
+// Interface so it can be handed a fake in tests, or a decorator adding
+// metrics, retries and the like.
+//
+// It is not called Checkpointer since that name belongs to the default
+// implementation, which existing RecordProcessors refer to.
+type Interface interface {
+	// CheckpointBatch checkpoints the last record of the latest batch
+	// handed to the processor.
+	CheckpointBatch() error
+	// CheckpointSeqNum checkpoints the record with seqNum.
+	CheckpointSeqNum(seqNum string) error
+	// CheckpointSubSeqNum checkpoints a record of a KPL aggregated
+	// record.
+	CheckpointSubSeqNum(seqNum string, subSeqNum int) error
 }
 
+var _ Interface = (*Checkpointer)(nil)
+
+// Checkpointer is the default Interface, checkpointing with the KCL
+// Multilang process.
 type Checkpointer struct {
 	input  *json.Decoder
 	output *json.Encoder
+	// acks replaces reading acks from input, see WithAckReader
+	acks func() (json.RawMessage, error)
+	// fn replaces the round trip to the KCL Multilang process when the
+	// checkpointer was created with NewCheckpointerFunc
+	fn        func(seqNum *string, subSeqNum *int) error
+	observers []func(o Observation)
+	tap       *wiretap.Recorder
+}
+
+// Observation describes a completed checkpoint round trip to the KCL
+// Multilang process.
+type Observation struct {
+	// SeqNum is nil for CheckpointBatch
+	SeqNum *string
+	// SubSeqNum is nil unless CheckpointSubSeqNum was used
+	SubSeqNum *int
+	Start     time.Time
+	Duration  time.Duration
+	Err       error
 }
 
-func NewCheckpointer(input io.Reader, output io.Writer) *Checkpointer {
-	return &Checkpointer{
-		input:  json.NewDecoder(input),
-		output: json.NewEncoder(output),
+type CheckpointerOpts func(c *Checkpointer)
+
+func NewCheckpointer(input io.Reader, output io.Writer, opts ...CheckpointerOpts) *Checkpointer {
+	c := &Checkpointer{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.tap != nil {
+		input = c.tap.Reader(input, wiretap.In)
+		output = c.tap.Writer(output, wiretap.Out)
 	}
+	c.input = json.NewDecoder(input)
+	c.output = json.NewEncoder(output)
+	return c
 }
 
-func (c *Checkpointer) checkKCLResp() error {
-	var resp checkPointResp
-	err := c.input.Decode(&resp)
-	if err != nil {
-		return err
+// WithWireTap records the checkpoints sent and the acks received to
+// rec. There is no need for it when the Checkpointer belongs to a
+// MultilangInterface that is already tapped.
+func WithWireTap(rec *wiretap.Recorder) CheckpointerOpts {
+	return func(c *Checkpointer) {
+		c.tap = rec
 	}
+}
 
-	if resp.Error != "" {
-		return fmt.Errorf("bad checkpoint ack from kcl multilang process: %s", resp.Error)
+// WithAckReader makes the checkpointer take the acks to its checkpoints
+// from next instead of decoding them from its input, for when the input
+// is read by something else too, which would otherwise read ahead into
+// the acks. next returns the next ack as it was received.
+func WithAckReader(next func() (json.RawMessage, error)) CheckpointerOpts {
+	return func(c *Checkpointer) {
+		c.acks = next
 	}
-	return nil
 }
 
-func (c *Checkpointer) CheckpointBatch() error {
-	output := map[string]string{"action": "checkpoint"}
-	err := c.output.Encode(output)
-	if err != nil {
-		return err
+// WithObserver calls fn after every checkpoint round trip to the KCL
+// Multilang process. It can be given more than once to add several
+// observers.
+func WithObserver(fn func(o Observation)) CheckpointerOpts {
+	return func(c *Checkpointer) {
+		c.observers = append(c.observers, fn)
 	}
+}
 
-	err = c.checkKCLResp()
-	if err != nil {
-		return err
+// NewCheckpointerFunc creates a Checkpointer that hands every checkpoint
+// to fn instead of sending it to the KCL Multilang process. seqNum is nil
+// for CheckpointBatch, and subSeqNum is nil unless CheckpointSubSeqNum
+// was used. This is useful for code that sits between Manager and a
+// RecordProcessor and needs to see (or hold back) its checkpoints.
+func NewCheckpointerFunc(fn func(seqNum *string, subSeqNum *int) error) *Checkpointer {
+	return &Checkpointer{fn: fn}
+}
+
+// AsCheckpointer returns cp as a *Checkpointer, for handing an
+// Interface to code that predates it. cp is returned as is if it
+// already is a *Checkpointer, and wrapped with NewCheckpointerFunc
+// otherwise.
+func AsCheckpointer(cp Interface) *Checkpointer {
+	if cp == nil {
+		return nil
 	}
-	return nil
+	if c, ok := cp.(*Checkpointer); ok {
+		return c
+	}
+	return NewCheckpointerFunc(func(seqNum *string, subSeqNum *int) error {
+		switch {
+		case seqNum == nil:
+			return cp.CheckpointBatch()
+		case subSeqNum == nil:
+			return cp.CheckpointSeqNum(*seqNum)
+		default:
+			return cp.CheckpointSubSeqNum(*seqNum, *subSeqNum)
+		}
+	})
 }
-func (c *Checkpointer) CheckpointSeqNum(seqNum string) error {
-	output := map[string]any{
-		"action":         "checkpoint",
-		"sequenceNumber": seqNum,
+
+func (c *Checkpointer) nextAck() (json.RawMessage, error) {
+	if c.acks != nil {
+		return c.acks()
 	}
-	err := c.output.Encode(output)
+	var raw json.RawMessage
+	err := c.input.Decode(&raw)
+	return raw, err
+}
+
+func (c *Checkpointer) checkKCLResp() error {
+	raw, err := c.nextAck()
 	if err != nil {
-		return err
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		return &InvalidAckError{Err: err}
 	}
-
-	err = c.checkKCLResp()
+	var resp checkPointResp
+	err = json.Unmarshal(raw, &resp)
 	if err != nil {
-		return err
+		return &InvalidAckError{Err: err}
+	}
+	if resp.Action != "checkpoint" {
+		return &InvalidAckError{Err: fmt.Errorf("unexpected action %q", resp.Action)}
+	}
+
+	if resp.Error != "" {
+		return &AckError{Err: resp.Error}
 	}
 	return nil
 }
-func (c *Checkpointer) CheckpointSubSeqNum(seqNum string, subSeqNum int) error {
-	output := map[string]any{
-		"action":            "checkpoint",
-		"sequenceNumber":    seqNum,
-		"subSequenceNumber": subSeqNum,
+
+func (c *Checkpointer) checkpoint(seqNum *string, subSeqNum *int) (err error) {
+	if c.fn != nil {
+		return c.fn(seqNum, subSeqNum)
+	}
+	if len(c.observers) > 0 {
+		start := time.Now()
+		defer func() {
+			o := Observation{
+				SeqNum:    seqNum,
+				SubSeqNum: subSeqNum,
+				Start:     start,
+				Duration:  time.Since(start),
+				Err:       err,
+			}
+			for _, fn := range c.observers {
+				fn(o)
+			}
+		}()
+	}
+
+	output := map[string]any{"action": "checkpoint"}
+	if seqNum != nil {
+		output["sequenceNumber"] = *seqNum
+	}
+	if subSeqNum != nil {
+		output["subSequenceNumber"] = *subSeqNum
 	}
-	err := c.output.Encode(output)
+	err = c.output.Encode(output)
 	if err != nil {
 		return err
 	}
@@ -84,3 +237,13 @@ func (c *Checkpointer) CheckpointSubSeqNum(seqNum string, subSeqNum int) error {
 	}
 	return nil
 }
+
+func (c *Checkpointer) CheckpointBatch() error {
+	return c.checkpoint(nil, nil)
+}
+func (c *Checkpointer) CheckpointSeqNum(seqNum string) error {
+	return c.checkpoint(&seqNum, nil)
+}
+func (c *Checkpointer) CheckpointSubSeqNum(seqNum string, subSeqNum int) error {
+	return c.checkpoint(&seqNum, &subSeqNum)
+}
@@ -0,0 +1,67 @@
+package checkpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func FuzzCheckKCLResp(f *testing.F) {
+	// acks as the KCL Multilang process sends them
+	f.Add([]byte(`{"action":"checkpoint","sequenceNumber":null,"subSequenceNumber":null,"error":""}`))
+	f.Add([]byte(`{"action":"checkpoint","sequenceNumber":"49590338271490256608561711338831091224701278195820789858","subSequenceNumber":0,"error":""}`))
+	f.Add([]byte(`{"action":"checkpoint","sequenceNumber":"49590338271490256608561711338831091224701278195820789858","subSequenceNumber":null,"error":"ThrottlingException"}`))
+	f.Add([]byte(`{"action":"checkpoint","error":"ShutdownException"}`))
+	f.Add([]byte(`{"action":"shutdownRequested"}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := NewCheckpointer(bytes.NewReader(data), io.Discard)
+		err := c.CheckpointBatch()
+		if err == nil {
+			return
+		}
+		var ackErr *AckError
+		var invalidErr *InvalidAckError
+		switch {
+		case errors.As(err, &ackErr):
+			assert.NotEmpty(t, ackErr.Err)
+		case errors.As(err, &invalidErr):
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		default:
+			t.Errorf("untyped error for ack %q: %v", data, err)
+		}
+	})
+}
+
+func TestCheckKCLResp(t *testing.T) {
+	t.Run("rejects message that is not an ack", func(t *testing.T) {
+		c := NewCheckpointer(bytes.NewBufferString(`{"action":"shutdownRequested"}`), io.Discard)
+		var invalidErr *InvalidAckError
+		assert.ErrorAs(t, c.CheckpointBatch(), &invalidErr)
+	})
+
+	t.Run("reports ack error", func(t *testing.T) {
+		c := NewCheckpointer(bytes.NewBufferString(`{"action":"checkpoint","error":"ThrottlingException"}`), io.Discard)
+		var ackErr *AckError
+		if assert.ErrorAs(t, c.CheckpointSeqNum("1"), &ackErr) {
+			assert.Equal(t, "ThrottlingException", ackErr.Err)
+		}
+	})
+	t.Run("takes acks from ack reader", func(t *testing.T) {
+		acks := []string{`{"action":"checkpoint","error":""}`}
+		c := NewCheckpointer(bytes.NewBufferString(`{"action":"checkpoint","error":"ThrottlingException"}`), io.Discard,
+			WithAckReader(func() (json.RawMessage, error) {
+				if len(acks) == 0 {
+					return nil, io.EOF
+				}
+				ack := acks[0]
+				acks = acks[1:]
+				return json.RawMessage(ack), nil
+			}))
+		assert.NoError(t, c.CheckpointBatch())
+		assert.ErrorIs(t, c.CheckpointBatch(), io.EOF)
+	})
+}
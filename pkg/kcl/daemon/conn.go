@@ -0,0 +1,232 @@
+// Package daemon implements the KCL MultiLangDaemon's side of the
+// multilang protocol, to run record processor binaries without the
+// Java KCL: it starts a processor, sends it actions, answers its
+// checkpoints and waits for its status responses.
+package daemon
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+)
+
+// Errors a CheckpointFunc can answer a checkpoint with. They are sent
+// to the processor by name, like the KCL does with its exceptions.
+var (
+	ErrThrottling   = errors.New("ThrottlingException")
+	ErrShutdown     = errors.New("ShutdownException")
+	ErrInvalidState = errors.New("InvalidStateException")
+)
+
+// Checkpoint is a checkpoint a processor made. A CheckpointBatch is
+// resolved to the last record of the batch it was made for.
+type Checkpoint struct {
+	SequenceNumber    string `json:"sequenceNumber,omitempty"`
+	SubSequenceNumber int    `json:"subSequenceNumber"`
+	// ShardEnd is set for the checkpoint made while the shard ended,
+	// which marks the shard as done
+	ShardEnd bool `json:"shardEnd,omitempty"`
+}
+
+// compare compares rec with cp like cmp.Compare: -1 if rec is before
+// cp, 0 if it is the checkpointed record and +1 if it is after. Only
+// records with the checkpoint's sequence number compare, ok is false
+// for the others. A checkpoint without a sub sequence number has sub
+// sequence number 0, the first record of an aggregated record.
+func (cp Checkpoint) compare(rec actions.Record) (c int, ok bool) {
+	if rec.SequenceNumber != cp.SequenceNumber {
+		return 0, false
+	}
+	return cmp.Compare(rec.SubSequenceNumber, cp.SubSequenceNumber), true
+}
+
+// CheckpointFunc is called for every checkpoint a processor makes. A
+// non nil error is sent back to the processor as the checkpoint's
+// error, e.g. ErrThrottling.
+type CheckpointFunc func(cp Checkpoint) error
+
+// ProtocolError is returned when a processor sends something the
+// multilang protocol does not allow.
+type ProtocolError struct {
+	Msg string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("multilang protocol error: %s", e.Msg)
+}
+
+type message struct {
+	Action            string  `json:"action"`
+	ResponseFor       string  `json:"responseFor"`
+	SequenceNumber    *string `json:"sequenceNumber"`
+	SubSequenceNumber *int    `json:"subSequenceNumber"`
+}
+
+type checkpointAck struct {
+	Action            string  `json:"action"`
+	SequenceNumber    *string `json:"sequenceNumber"`
+	SubSequenceNumber *int    `json:"subSequenceNumber"`
+	Error             string  `json:"error"`
+}
+
+// Conn speaks the multilang protocol to a processor over its stdin and
+// stdout. It is not safe for concurrent use, the protocol handles one
+// action at a time.
+type Conn struct {
+	enc        *json.Encoder
+	dec        *json.Decoder
+	checkpoint CheckpointFunc
+
+	// last is the last record delivered, used to resolve batch
+	// checkpoints
+	last    *actions.Record
+	current string
+}
+
+// NewConn creates a Conn reading the processor's messages from r and
+// sending it actions on w. Checkpoints are handed to fn, or succeed if
+// fn is nil.
+func NewConn(r io.Reader, w io.Writer, fn CheckpointFunc) *Conn {
+	return &Conn{
+		enc:        json.NewEncoder(w),
+		dec:        json.NewDecoder(r),
+		checkpoint: fn,
+	}
+}
+
+// Initialize sends the initialize action. seqNum is where the shard
+// was last checkpointed, or the initial position in the stream.
+func (c *Conn) Initialize(shardId, seqNum string, subSeqNum int) error {
+	return c.send(actions.InitAction{
+		Action:    actions.INITITALIZE,
+		ShardId:   shardId,
+		SeqNum:    seqNum,
+		SubSeqNum: subSeqNum,
+	})
+}
+
+// ProcessRecords sends a batch of records.
+func (c *Conn) ProcessRecords(records []actions.Record, millisBehindLatest int) error {
+	if records == nil {
+		records = []actions.Record{}
+	}
+	if len(records) > 0 {
+		last := records[len(records)-1]
+		c.last = &last
+	}
+	return c.send(actions.ProcessAction{
+		Action:             actions.PROCESS_RECORDS,
+		MillisBehindLatest: millisBehindLatest,
+		Records:            records,
+	})
+}
+
+// LeaseLost sends the leaseLost action.
+func (c *Conn) LeaseLost() error {
+	return c.send(actions.LeaseLostAction{Action: actions.LEASE_LOST})
+}
+
+// ShardEnded sends the shardEnded action.
+func (c *Conn) ShardEnded() error {
+	return c.send(actions.ShardEndedAction{Action: actions.SHARD_ENDED})
+}
+
+// ShutdownRequested sends the shutdownRequested action.
+func (c *Conn) ShutdownRequested() error {
+	return c.send(actions.ShutdownRequestedAction{Action: actions.SHUTDOWN_REQUESTED})
+}
+
+// send sends action and answers checkpoints until the processor sends
+// its status response for it.
+func (c *Conn) send(action any) error {
+	b, err := json.Marshal(action)
+	if err != nil {
+		return err
+	}
+	var a struct {
+		Action string `json:"action"`
+	}
+	json.Unmarshal(b, &a)
+	c.current = a.Action
+	err = c.enc.Encode(json.RawMessage(b))
+	if err != nil {
+		return fmt.Errorf("error sending %s: %w", a.Action, err)
+	}
+	for {
+		var msg message
+		err := c.dec.Decode(&msg)
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("processor exited while handling %s: %w", a.Action, io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return fmt.Errorf("error reading response to %s: %w", a.Action, err)
+		}
+		switch msg.Action {
+		case "checkpoint":
+			err = c.answer(msg)
+			if err != nil {
+				return err
+			}
+		case "status":
+			if msg.ResponseFor != a.Action {
+				return &ProtocolError{Msg: fmt.Sprintf("status response for %q while waiting on %q", msg.ResponseFor, a.Action)}
+			}
+			return nil
+		default:
+			return &ProtocolError{Msg: fmt.Sprintf("unexpected message %q while waiting on %q", msg.Action, a.Action)}
+		}
+	}
+}
+
+// answer hands a checkpoint to the CheckpointFunc and acks it.
+func (c *Conn) answer(msg message) error {
+	var err error
+	switch c.current {
+	case actions.LEASE_LOST, actions.INITITALIZE:
+		// there is no lease to checkpoint for
+		err = ErrShutdown
+	default:
+		// like KCL, a batch checkpoint before any record was delivered
+		// stays where the shard started and succeeds
+		cp, ok := c.resolve(msg)
+		if ok && c.checkpoint != nil {
+			err = c.checkpoint(cp)
+		}
+	}
+	ack := checkpointAck{
+		Action:            "checkpoint",
+		SequenceNumber:    msg.SequenceNumber,
+		SubSequenceNumber: msg.SubSequenceNumber,
+	}
+	if err != nil {
+		ack.Error = err.Error()
+	}
+	err = c.enc.Encode(ack)
+	if err != nil {
+		return fmt.Errorf("error sending checkpoint ack: %w", err)
+	}
+	return nil
+}
+
+// resolve turns a checkpoint message into a Checkpoint, and false if a
+// batch checkpoint was made before any record was delivered.
+func (c *Conn) resolve(msg message) (Checkpoint, bool) {
+	if msg.SequenceNumber != nil {
+		cp := Checkpoint{SequenceNumber: *msg.SequenceNumber}
+		if msg.SubSequenceNumber != nil {
+			cp.SubSequenceNumber = *msg.SubSequenceNumber
+		}
+		return cp, true
+	}
+	if c.current == actions.SHARD_ENDED {
+		return Checkpoint{ShardEnd: true}, true
+	}
+	if c.last == nil {
+		return Checkpoint{}, false
+	}
+	return Checkpoint{SequenceNumber: c.last.SequenceNumber, SubSequenceNumber: c.last.SubSequenceNumber}, true
+}
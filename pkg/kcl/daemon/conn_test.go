@@ -0,0 +1,121 @@
+package daemon
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+// connect runs a Manager for rp in a goroutine and connects a Conn to
+// it. It uses os pipes, which buffer like a child's stdin and stdout do.
+func connect(t *testing.T, rp kcl.RecordProcessor, fn CheckpointFunc) *Conn {
+	stdinR, stdinW, err := os.Pipe()
+	assert.NoError(t, err)
+	stdoutR, stdoutW, err := os.Pipe()
+	assert.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		quiet := kcl.WithManagerLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+		kcl.NewManager(stdinR, stdoutW, rp, quiet).Start()
+		stdoutW.Close()
+	}()
+	t.Cleanup(func() {
+		stdinW.Close()
+		<-done
+		stdinR.Close()
+		stdoutR.Close()
+	})
+	return NewConn(stdoutR, stdinW, fn)
+}
+
+func TestConn(t *testing.T) {
+	t.Run("resolves checkpoints", func(t *testing.T) {
+		var leaseLostErr error
+		var saved *checkpoint.Checkpointer
+		rp := &kcl.RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				saved = cp
+				if err := cp.CheckpointSeqNum(records[0].SequenceNumber); err != nil {
+					return err
+				}
+				return cp.CheckpointBatch()
+			},
+			LeaseLostFunc: func() error {
+				leaseLostErr = saved.CheckpointBatch()
+				return nil
+			},
+		}
+		var cps []Checkpoint
+		c := connect(t, rp, func(cp Checkpoint) error {
+			cps = append(cps, cp)
+			return nil
+		})
+		records := GenerateRecords(3)
+
+		assert.NoError(t, c.Initialize("shardId-000", TrimHorizon, 0))
+		assert.NoError(t, c.ProcessRecords(records, 0))
+		assert.NoError(t, c.ShardEnded())
+		assert.NoError(t, c.LeaseLost())
+		assert.Equal(t, []Checkpoint{
+			{SequenceNumber: records[0].SequenceNumber},
+			{SequenceNumber: records[2].SequenceNumber},
+			{ShardEnd: true},
+		}, cps)
+		var ackErr *checkpoint.AckError
+		if assert.ErrorAs(t, leaseLostErr, &ackErr) {
+			assert.Equal(t, ErrShutdown.Error(), ackErr.Err)
+		}
+	})
+
+	t.Run("answers checkpoint with error", func(t *testing.T) {
+		var got error
+		rp := &kcl.RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				got = cp.CheckpointBatch()
+				return nil
+			},
+		}
+		c := connect(t, rp, func(cp Checkpoint) error { return ErrThrottling })
+
+		assert.NoError(t, c.ProcessRecords(GenerateRecords(1), 0))
+		var ackErr *checkpoint.AckError
+		if assert.ErrorAs(t, got, &ackErr) {
+			assert.Equal(t, "ThrottlingException", ackErr.Err)
+		}
+	})
+
+	t.Run("batch checkpoint before any record succeeds", func(t *testing.T) {
+		var got error
+		rp := &kcl.RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				got = cp.CheckpointBatch()
+				return nil
+			},
+		}
+		called := false
+		c := connect(t, rp, func(cp Checkpoint) error { called = true; return nil })
+
+		assert.NoError(t, c.ProcessRecords(nil, 0))
+		assert.NoError(t, got)
+		assert.False(t, called)
+	})
+
+	t.Run("reports processor exiting", func(t *testing.T) {
+		rp := &kcl.RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				return errors.New("boom")
+			},
+		}
+		c := connect(t, rp, nil)
+
+		assert.ErrorIs(t, c.ProcessRecords(GenerateRecords(1), 0), io.ErrUnexpectedEOF)
+	})
+}
@@ -0,0 +1,362 @@
+package daemon
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/internal/prefixio"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+)
+
+// Initial positions in the stream for a shard without a checkpoint.
+const (
+	TrimHorizon = "TRIM_HORIZON"
+	Latest      = "LATEST"
+)
+
+// Local runs a record processor against an in-memory stream, like a
+// single KCL worker holding the lease of every shard: every shard gets
+// its own processor, records are delivered in batches and checkpoints
+// are saved to a Store, so a new run resumes where the last one
+// stopped.
+//
+// Records are spread over the shards by the md5 hash of their partition
+// key, like Kinesis does. With WithReshardAfter, every shard ends after
+// that many records and splits in two child shards, which start once
+// the parent's processor checkpointed the shard end.
+type Local struct {
+	command         string
+	records         []actions.Record
+	store           *Store
+	shards          int
+	batchSize       int
+	reshardAfter    int
+	stealLeaseAfter int
+	initialPosition string
+	stderr          io.Writer
+	stderrMu        sync.Mutex
+	loggr           *slog.Logger
+}
+
+type LocalOpts func(l *Local)
+
+// WithShards sets the number of shards the stream starts with. It
+// defaults to 1.
+func WithShards(n int) LocalOpts {
+	return func(l *Local) {
+		l.shards = n
+	}
+}
+
+// WithBatchSize sets the maximum number of records per processRecords
+// action. It defaults to 100.
+func WithBatchSize(n int) LocalOpts {
+	return func(l *Local) {
+		l.batchSize = n
+	}
+}
+
+// WithReshardAfter ends every shard after n records and splits it in
+// two child shards holding the rest of its records.
+func WithReshardAfter(n int) LocalOpts {
+	return func(l *Local) {
+		l.reshardAfter = n
+	}
+}
+
+// WithLeaseStealAfter makes another worker steal the lease of the first
+// shard once, after n records were delivered: its processor gets
+// leaseLost and is stopped, then a new processor takes the shard over
+// from its last checkpoint.
+func WithLeaseStealAfter(n int) LocalOpts {
+	return func(l *Local) {
+		l.stealLeaseAfter = n
+	}
+}
+
+// WithInitialPosition sets where shards without a checkpoint start,
+// TrimHorizon (the default) or Latest. Like in KCL, child shards always
+// start at TrimHorizon.
+func WithInitialPosition(pos string) LocalOpts {
+	return func(l *Local) {
+		l.initialPosition = pos
+	}
+}
+
+// WithStderr copies the processors' stderr to w, each line prefixed
+// with the shard ID.
+func WithStderr(w io.Writer) LocalOpts {
+	return func(l *Local) {
+		l.stderr = w
+	}
+}
+
+// WithLocalLogger sets the logger for what happens to the shards.
+func WithLocalLogger(loggr *slog.Logger) LocalOpts {
+	return func(l *Local) {
+		l.loggr = loggr
+	}
+}
+
+// NewLocal creates a Local running the processor command line over
+// records, saving checkpoints to store.
+func NewLocal(command string, records []actions.Record, store *Store, opts ...LocalOpts) *Local {
+	l := &Local{
+		command:         command,
+		records:         records,
+		store:           store,
+		shards:          1,
+		batchSize:       100,
+		initialPosition: TrimHorizon,
+		loggr:           slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// shard is a shard of the in-memory stream. It owns the hash keys from
+// lo to hi.
+type shard struct {
+	id       string
+	num      int
+	lo, hi   uint64
+	records  []actions.Record
+	children []*shard
+	root     bool
+}
+
+// topology spreads the records over the shards, splitting shards that
+// reshard. It only depends on the records and options, so every run
+// builds the same shards.
+func (l *Local) topology() []*shard {
+	roots := make([]*shard, l.shards)
+	width := math.MaxUint64/uint64(l.shards) + 1
+	for i := range roots {
+		roots[i] = &shard{num: i, lo: uint64(i) * width, hi: uint64(i)*width + (width - 1), root: true}
+		if i == l.shards-1 {
+			roots[i].hi = math.MaxUint64
+		}
+	}
+	for _, r := range l.records {
+		h := hashKey(r.PartitionKey)
+		for _, s := range roots {
+			if h >= s.lo && h <= s.hi {
+				s.records = append(s.records, r)
+				break
+			}
+		}
+	}
+	for _, s := range roots {
+		l.split(s)
+	}
+	return roots
+}
+
+// split moves the records of s past reshardAfter into two children.
+// Children of shard k are numbered shards+2k and shards+2k+1, so shard
+// IDs stay the same across runs.
+func (l *Local) split(s *shard) {
+	s.id = fmt.Sprintf("shardId-%012d", s.num)
+	if l.reshardAfter <= 0 || len(s.records) <= l.reshardAfter {
+		return
+	}
+	mid := s.lo + (s.hi-s.lo)/2
+	left := &shard{num: l.shards + 2*s.num, lo: s.lo, hi: mid}
+	right := &shard{num: l.shards + 2*s.num + 1, lo: mid + 1, hi: s.hi}
+	for _, r := range s.records[l.reshardAfter:] {
+		if hashKey(r.PartitionKey) <= mid {
+			left.records = append(left.records, r)
+		} else {
+			right.records = append(right.records, r)
+		}
+	}
+	s.records = s.records[:l.reshardAfter]
+	s.children = []*shard{left, right}
+	l.split(left)
+	l.split(right)
+}
+
+func hashKey(partitionKey string) uint64 {
+	sum := md5.Sum([]byte(partitionKey))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// Run runs the processors until every shard was read to its end, or
+// ctx is cancelled. Either way every processor still running gets
+// shutdownRequested, like on a graceful KCL shutdown. Processors are
+// not killed when ctx is cancelled, they exit once their input closes.
+func (l *Local) Run(ctx context.Context) error {
+	if l.initialPosition != TrimHorizon && l.initialPosition != Latest {
+		return fmt.Errorf("unsupported initial position %q, must be %s or %s", l.initialPosition, TrimHorizon, Latest)
+	}
+	if l.shards < 1 || l.batchSize < 1 {
+		return fmt.Errorf("shards and batch size must be at least 1")
+	}
+	return l.runShards(ctx, l.topology())
+}
+
+func (l *Local) runShards(ctx context.Context, shards []*shard) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(shards))
+	for i, s := range shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = l.runShard(ctx, s)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// runShard processes s and then its children.
+func (l *Local) runShard(ctx context.Context, s *shard) error {
+	loggr := l.loggr.With("shard_id", s.id)
+	steal := s.root && s.num == 0 && l.stealLeaseAfter > 0
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		cp, ok := l.store.Get(s.id)
+		if ok && cp.ShardEnd {
+			loggr.Info("shard already ended, moving on to its children")
+			return l.runShards(ctx, s.children)
+		}
+		start := 0
+		if ok {
+			var err error
+			start, err = resumeAt(s, cp)
+			if err != nil {
+				return err
+			}
+		} else if s.root && l.initialPosition == Latest {
+			start = len(s.records)
+		}
+		ended, stolen, err := l.lease(ctx, loggr, s, start, steal)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.id, err)
+		}
+		if stolen {
+			loggr.Info("lease stolen, taking the shard over from its last checkpoint")
+			steal = false
+			continue
+		}
+		if !ended {
+			return nil
+		}
+		if cp, _ := l.store.Get(s.id); !cp.ShardEnd {
+			loggr.Error("processor did not checkpoint the shard end, not starting its children")
+			return fmt.Errorf("%s: shard end was not checkpointed", s.id)
+		}
+		return l.runShards(ctx, s.children)
+	}
+}
+
+// resumeAt returns the index of the first record of s after cp.
+func resumeAt(s *shard, cp Checkpoint) (int, error) {
+	found := -1
+	for i, r := range s.records {
+		if c, ok := cp.compare(r); ok && c <= 0 {
+			found = i
+		}
+	}
+	if found < 0 {
+		return 0, fmt.Errorf("%s: checkpoint at sequence number %s is not in the stream", s.id, cp.SequenceNumber)
+	}
+	return found + 1, nil
+}
+
+// lease runs a processor for s from the record at start until the
+// shard ends, the stream runs dry, ctx is cancelled or the lease is
+// stolen.
+func (l *Local) lease(ctx context.Context, loggr *slog.Logger, s *shard, start int, steal bool) (ended, stolen bool, err error) {
+	var stderr io.Writer
+	var prefixed *prefixio.Writer
+	if l.stderr != nil {
+		prefixed = prefixio.NewWriter(l.stderr, &l.stderrMu, fmt.Sprintf("[%s] ", s.id))
+		stderr = prefixed
+	}
+	proc, err := StartProcess(context.WithoutCancel(ctx), l.command, stderr, l.checkpointer(s))
+	if err != nil {
+		return false, false, err
+	}
+	defer func() {
+		closeErr := proc.Close()
+		if prefixed != nil {
+			prefixed.Flush()
+		}
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	seqNum, subSeqNum := l.initialPosition, 0
+	if !s.root {
+		seqNum = TrimHorizon
+	}
+	if cp, ok := l.store.Get(s.id); ok {
+		seqNum, subSeqNum = cp.SequenceNumber, cp.SubSequenceNumber
+	}
+	loggr.Info("initializing processor", "sequence_number", seqNum)
+	err = proc.Initialize(s.id, seqNum, subSeqNum)
+	if err != nil {
+		return false, false, err
+	}
+
+	delivered := 0
+	for pos := start; pos < len(s.records); {
+		if ctx.Err() != nil {
+			loggr.Info("shutdown requested")
+			return false, false, proc.ShutdownRequested()
+		}
+		batch := s.records[pos:min(pos+l.batchSize, len(s.records))]
+		err = proc.ProcessRecords(batch, millisBehind(batch))
+		if err != nil {
+			return false, false, err
+		}
+		pos += len(batch)
+		delivered += len(batch)
+		if steal && delivered >= l.stealLeaseAfter && pos < len(s.records) {
+			return false, true, proc.LeaseLost()
+		}
+	}
+	if len(s.children) > 0 {
+		loggr.Info("shard ended", "children", []string{s.children[0].id, s.children[1].id})
+		return true, false, proc.ShardEnded()
+	}
+	loggr.Info("read to the end of the shard, shutting down")
+	return false, false, proc.ShutdownRequested()
+}
+
+// checkpointer saves the checkpoints made for s, rejecting those for
+// records that are not in the shard.
+func (l *Local) checkpointer(s *shard) CheckpointFunc {
+	return func(cp Checkpoint) error {
+		if !cp.ShardEnd {
+			if _, err := resumeAt(s, cp); err != nil {
+				return ErrInvalidState
+			}
+		}
+		err := l.store.Set(s.id, cp)
+		if err != nil {
+			l.loggr.Error("error saving checkpoint", "shard_id", s.id, "error", err)
+			return ErrThrottling
+		}
+		return nil
+	}
+}
+
+func millisBehind(batch []actions.Record) int {
+	last := time.UnixMilli(int64(batch[len(batch)-1].ApproximateArrivalTimestamp))
+	return max(int(time.Since(last).Milliseconds()), 0)
+}
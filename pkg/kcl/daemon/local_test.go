@@ -0,0 +1,157 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var processedLine = regexp.MustCompile(`(?m)^\[(shardId-\d+)\] processed (.*)$`)
+
+// processed returns the payloads processed per shard, according to the
+// test processor's stderr.
+func processed(stderr string) (map[string][]string, []string) {
+	perShard := map[string][]string{}
+	var all []string
+	for _, m := range processedLine.FindAllStringSubmatch(stderr, -1) {
+		perShard[m[1]] = append(perShard[m[1]], m[2])
+		all = append(all, m[2])
+	}
+	sort.Strings(all)
+	return perShard, all
+}
+
+func payloads(n int) []string {
+	var all []string
+	for _, r := range GenerateRecords(n) {
+		all = append(all, decode(r.Data))
+	}
+	sort.Strings(all)
+	return all
+}
+
+func openStore(t *testing.T) *Store {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "checkpoints.json"))
+	assert.NoError(t, err)
+	return store
+}
+
+var quietLogger = WithLocalLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+func TestLocal(t *testing.T) {
+	t.Run("delivers every record once across shards", func(t *testing.T) {
+		stderr := &bytes.Buffer{}
+		store := openStore(t)
+		l := NewLocal(testProcessor(t, "checkpoint"), GenerateRecords(50), store,
+			WithShards(2), WithBatchSize(7), WithStderr(stderr), quietLogger)
+
+		assert.NoError(t, l.Run(context.Background()))
+		perShard, all := processed(stderr.String())
+		assert.Equal(t, payloads(50), all)
+		assert.Len(t, perShard, 2)
+		for _, id := range []string{"shardId-000000000000", "shardId-000000000001"} {
+			cp, ok := store.Get(id)
+			assert.True(t, ok)
+			assert.NotEmpty(t, cp.SequenceNumber)
+		}
+	})
+
+	t.Run("reshards into child shards", func(t *testing.T) {
+		stderr := &bytes.Buffer{}
+		store := openStore(t)
+		l := NewLocal(testProcessor(t, "checkpoint"), GenerateRecords(40), store,
+			WithReshardAfter(10), WithBatchSize(4), WithStderr(stderr), quietLogger)
+
+		assert.NoError(t, l.Run(context.Background()))
+		perShard, all := processed(stderr.String())
+		assert.Equal(t, payloads(40), all)
+		assert.Len(t, perShard["shardId-000000000000"], 10)
+		assert.Len(t, perShard["shardId-000000000001"], 10)
+		assert.Len(t, perShard["shardId-000000000002"], 10)
+		cp, _ := store.Get("shardId-000000000000")
+		assert.True(t, cp.ShardEnd)
+	})
+
+	t.Run("does not start children without shard end checkpoint", func(t *testing.T) {
+		stderr := &bytes.Buffer{}
+		l := NewLocal(testProcessor(t, "no-shard-end"), GenerateRecords(20), openStore(t),
+			WithReshardAfter(10), WithStderr(stderr), quietLogger)
+
+		assert.ErrorContains(t, l.Run(context.Background()), "shard end was not checkpointed")
+		perShard, _ := processed(stderr.String())
+		assert.Len(t, perShard, 1)
+	})
+
+	t.Run("resumes from checkpoints", func(t *testing.T) {
+		store := openStore(t)
+		records := GenerateRecords(30)
+		cmd := testProcessor(t, "checkpoint")
+		assert.NoError(t, NewLocal(cmd, records[:20], store, WithReshardAfter(15), quietLogger).Run(context.Background()))
+
+		stderr := &bytes.Buffer{}
+		reopened, err := OpenStore(store.path)
+		assert.NoError(t, err)
+		assert.NoError(t, NewLocal(cmd, records, reopened, WithReshardAfter(15), WithStderr(stderr), quietLogger).Run(context.Background()))
+		_, all := processed(stderr.String())
+		var want []string
+		for _, r := range records[20:] {
+			want = append(want, decode(r.Data))
+		}
+		sort.Strings(want)
+		assert.Equal(t, want, all)
+	})
+
+	t.Run("hands stolen lease to new processor", func(t *testing.T) {
+		stderr := &bytes.Buffer{}
+		l := NewLocal(testProcessor(t, "checkpoint"), GenerateRecords(30), openStore(t),
+			WithBatchSize(5), WithLeaseStealAfter(10), WithStderr(stderr), quietLogger)
+
+		assert.NoError(t, l.Run(context.Background()))
+		_, all := processed(stderr.String())
+		assert.Equal(t, payloads(30), all)
+	})
+
+	t.Run("starts at latest", func(t *testing.T) {
+		stderr := &bytes.Buffer{}
+		l := NewLocal(testProcessor(t, "checkpoint"), GenerateRecords(20), openStore(t),
+			WithInitialPosition(Latest), WithReshardAfter(10), WithStderr(stderr), quietLogger)
+
+		assert.NoError(t, l.Run(context.Background()))
+		perShard, all := processed(stderr.String())
+		assert.Len(t, all, 10)
+		assert.Empty(t, perShard["shardId-000000000000"])
+	})
+
+	t.Run("delivers nothing once cancelled", func(t *testing.T) {
+		stderr := &bytes.Buffer{}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		l := NewLocal(testProcessor(t, "checkpoint"), GenerateRecords(20), openStore(t), WithStderr(stderr), quietLogger)
+
+		assert.NoError(t, l.Run(ctx))
+		assert.Empty(t, stderr.String())
+	})
+}
+
+func TestStore(t *testing.T) {
+	t.Run("keeps checkpoint that failed to save out of memory", func(t *testing.T) {
+		store := openStore(t)
+		saved := Checkpoint{SequenceNumber: SequenceNumber(1)}
+		assert.NoError(t, store.Set("shardId-000000000000", saved))
+
+		// a directory in place of the file makes the rename fail
+		assert.NoError(t, os.Mkdir(store.path+".d", 0o755))
+		store.path += ".d"
+		assert.Error(t, store.Set("shardId-000000000000", Checkpoint{SequenceNumber: SequenceNumber(2)}))
+		cp, _ := store.Get("shardId-000000000000")
+		assert.Equal(t, saved, cp)
+	})
+}
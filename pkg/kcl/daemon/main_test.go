@@ -0,0 +1,64 @@
+package daemon
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+)
+
+// processorEnv makes the test binary run as a record processor, so the
+// tests can start it as a child process.
+const processorEnv = "DAEMON_TEST_PROCESSOR"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(processorEnv); mode != "" {
+		os.Exit(runTestProcessor(mode))
+	}
+	os.Exit(m.Run())
+}
+
+// runTestProcessor checkpoints every batch and prints the data of every
+// record it processed to stderr. In mode "no-shard-end" it does not
+// checkpoint when its shard ends, and in mode "fail" it exits on a
+// record with the payload "fail", checkpointing the record before it.
+func runTestProcessor(mode string) int {
+	rp := &kcl.RecordProcessorFuncs{
+		ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+			for i, r := range records {
+				data, _ := base64.StdEncoding.DecodeString(r.Data)
+				if mode == "fail" && string(data) == "fail" {
+					if i > 0 {
+						cp.CheckpointSeqNum(records[i-1].SequenceNumber)
+					}
+					return fmt.Errorf("cannot process %s", r.SequenceNumber)
+				}
+				fmt.Fprintf(os.Stderr, "processed %s\n", data)
+			}
+			return cp.CheckpointBatch()
+		},
+	}
+	if mode == "no-shard-end" {
+		rp.ShardEndedFunc = func(cp *checkpoint.Checkpointer) error { return nil }
+	}
+	quiet := kcl.WithManagerLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	err := kcl.NewManager(os.Stdin, os.Stdout, rp, quiet).Start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// testProcessor returns the command line running the test binary as a
+// processor in mode.
+func testProcessor(t *testing.T, mode string) string {
+	t.Setenv(processorEnv, mode)
+	return os.Args[0]
+}
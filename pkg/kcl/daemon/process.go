@@ -0,0 +1,58 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Process is a record processor running as a child process, spoken to
+// over its stdin and stdout like the KCL MultiLangDaemon does.
+type Process struct {
+	*Conn
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+// StartProcess starts the processor command line, e.g. the
+// executableName of a properties file, and connects to it. The
+// processor's stderr is copied to stderr, which may be nil to discard
+// it. Cancelling ctx kills the processor.
+func StartProcess(ctx context.Context, command string, stderr io.Writer, fn CheckpointFunc) (*Process, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty processor command")
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("error starting processor %q: %w", command, err)
+	}
+	return &Process{
+		Conn:  NewConn(stdout, stdin, fn),
+		cmd:   cmd,
+		stdin: stdin,
+	}, nil
+}
+
+// Close closes the processor's stdin, which tells it to exit, and waits
+// for it to do so.
+func (p *Process) Close() error {
+	p.stdin.Close()
+	err := p.cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("processor exited: %w", err)
+	}
+	return nil
+}
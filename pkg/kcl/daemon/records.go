@@ -0,0 +1,124 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+)
+
+// Format is how records are stored in a file.
+type Format string
+
+const (
+	// FormatRecords is NDJSON of actions.Record, e.g. records archived
+	// from processRecords actions
+	FormatRecords Format = "records"
+	// FormatLines is one raw payload per line
+	FormatLines Format = "lines"
+)
+
+// RecordReader reads records from a file, one per line.
+type RecordReader struct {
+	scanner *bufio.Scanner
+	format  Format
+	now     func() time.Time
+	n       int
+}
+
+// NewRecordReader creates a RecordReader reading records in format
+// from r.
+func NewRecordReader(r io.Reader, format Format) (*RecordReader, error) {
+	if format != FormatRecords && format != FormatLines {
+		return nil, fmt.Errorf("unknown record format %q, must be %q or %q", format, FormatRecords, FormatLines)
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	return &RecordReader{scanner: scanner, format: format, now: time.Now}, nil
+}
+
+// Next returns the next record, and io.EOF once there are no more.
+// Records without a sequence number get one counting up from 1, and a
+// raw payload line gets its line number as partition key.
+func (rr *RecordReader) Next() (actions.Record, error) {
+	for rr.scanner.Scan() {
+		line := rr.scanner.Bytes()
+		rr.n++
+		var r actions.Record
+		switch rr.format {
+		case FormatRecords:
+			if len(line) == 0 {
+				continue
+			}
+			err := json.Unmarshal(line, &r)
+			if err != nil {
+				return r, fmt.Errorf("line %d: error decoding record: %w", rr.n, err)
+			}
+		case FormatLines:
+			r.Data = base64.StdEncoding.EncodeToString(line)
+			r.PartitionKey = strconv.Itoa(rr.n)
+		}
+		if r.Action == "" {
+			r.Action = "record"
+		}
+		if r.SequenceNumber == "" {
+			r.SequenceNumber = SequenceNumber(rr.n)
+		}
+		if r.ApproximateArrivalTimestamp == 0 {
+			r.ApproximateArrivalTimestamp = int(rr.now().UnixMilli())
+		}
+		return r, nil
+	}
+	err := rr.scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	return actions.Record{}, err
+}
+
+// ReadRecords reads every record in r.
+func ReadRecords(r io.Reader, format Format) ([]actions.Record, error) {
+	rr, err := NewRecordReader(r, format)
+	if err != nil {
+		return nil, err
+	}
+	var records []actions.Record
+	for {
+		rec, err := rr.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, rec)
+	}
+}
+
+// GenerateRecords generates n records with payloads "record-1" to
+// "record-<n>", for a stream without input files.
+func GenerateRecords(n int) []actions.Record {
+	now := int(time.Now().UnixMilli())
+	records := make([]actions.Record, n)
+	for i := range records {
+		records[i] = actions.Record{
+			Action:                      "record",
+			Data:                        base64.StdEncoding.EncodeToString(fmt.Appendf(nil, "record-%d", i+1)),
+			PartitionKey:                fmt.Sprintf("partitionKey-%d", i+1),
+			ApproximateArrivalTimestamp: now,
+			SequenceNumber:              SequenceNumber(i + 1),
+		}
+	}
+	return records
+}
+
+// SequenceNumber returns the n-th generated sequence number. They are
+// zero padded so they sort like the numbers they are.
+func SequenceNumber(n int) string {
+	return fmt.Sprintf("%020d", n)
+}
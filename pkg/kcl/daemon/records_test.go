@@ -0,0 +1,51 @@
+package daemon
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decode(data string) string {
+	b, _ := base64.StdEncoding.DecodeString(data)
+	return string(b)
+}
+
+func TestReadRecords(t *testing.T) {
+	t.Run("reads raw payload lines", func(t *testing.T) {
+		records, err := ReadRecords(strings.NewReader("hello\nworld\n"), FormatLines)
+		assert.NoError(t, err)
+		if assert.Len(t, records, 2) {
+			assert.Equal(t, "world", decode(records[1].Data))
+			assert.Equal(t, "2", records[1].PartitionKey)
+			assert.Equal(t, SequenceNumber(2), records[1].SequenceNumber)
+			assert.Less(t, records[0].SequenceNumber, records[1].SequenceNumber)
+		}
+	})
+
+	t.Run("reads archived records", func(t *testing.T) {
+		records, err := ReadRecords(strings.NewReader(`{"data":"aGVsbG8=","partitionKey":"pk","sequenceNumber":"4959","subSequenceNumber":1}
+
+{"data":"d29ybGQ="}
+`), FormatRecords)
+		assert.NoError(t, err)
+		if assert.Len(t, records, 2) {
+			assert.Equal(t, "record", records[0].Action)
+			assert.Equal(t, "4959", records[0].SequenceNumber)
+			assert.Equal(t, 1, records[0].SubSequenceNumber)
+			assert.Equal(t, SequenceNumber(3), records[1].SequenceNumber)
+		}
+	})
+
+	t.Run("reports line of bad record", func(t *testing.T) {
+		_, err := ReadRecords(strings.NewReader("{}\n{\n"), FormatRecords)
+		assert.ErrorContains(t, err, "line 2: error decoding record")
+	})
+
+	t.Run("rejects unknown format", func(t *testing.T) {
+		_, err := ReadRecords(strings.NewReader(""), "csv")
+		assert.Error(t, err)
+	})
+}
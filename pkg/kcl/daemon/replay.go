@@ -0,0 +1,314 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/internal/prefixio"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+)
+
+// Replay feeds archived records to a single processor, e.g. for a
+// backfill or to reproduce an incident, without Kinesis or the KCL. The
+// records are read as they are sent, so files of any size can be
+// replayed, and checkpoints are saved to a Store, so a replay that was
+// stopped or failed resumes after the last record checkpointed.
+type Replay struct {
+	command     string
+	records     *RecordReader
+	store       *Store
+	shardId     string
+	batchSize   int
+	shardEnd    bool
+	reportEvery time.Duration
+	stderr      io.Writer
+	loggr       *slog.Logger
+}
+
+type ReplayOpts func(r *Replay)
+
+// WithReplayShardId sets the shard the processor is told it reads, and
+// checkpoints are saved for. It defaults to shardId-000000000000.
+func WithReplayShardId(shardId string) ReplayOpts {
+	return func(r *Replay) {
+		r.shardId = shardId
+	}
+}
+
+// WithReplayBatchSize sets the maximum number of records per
+// processRecords action. It defaults to 100.
+func WithReplayBatchSize(n int) ReplayOpts {
+	return func(r *Replay) {
+		r.batchSize = n
+	}
+}
+
+// WithReplayShardEnd ends the shard after the last record, instead of
+// requesting a shutdown, so the processor runs its shard end logic.
+func WithReplayShardEnd(end bool) ReplayOpts {
+	return func(r *Replay) {
+		r.shardEnd = end
+	}
+}
+
+// WithReplayReportEvery logs the progress of the replay every d. It
+// defaults to 10 seconds.
+func WithReplayReportEvery(d time.Duration) ReplayOpts {
+	return func(r *Replay) {
+		r.reportEvery = d
+	}
+}
+
+// WithReplayStderr copies the processor's stderr to w.
+func WithReplayStderr(w io.Writer) ReplayOpts {
+	return func(r *Replay) {
+		r.stderr = w
+	}
+}
+
+// WithReplayLogger sets the logger for the replay's progress.
+func WithReplayLogger(loggr *slog.Logger) ReplayOpts {
+	return func(r *Replay) {
+		r.loggr = loggr
+	}
+}
+
+// NewReplay creates a Replay running the processor command line over
+// records, saving checkpoints to store.
+func NewReplay(command string, records *RecordReader, store *Store, opts ...ReplayOpts) *Replay {
+	r := &Replay{
+		command:     command,
+		records:     records,
+		store:       store,
+		shardId:     "shardId-000000000000",
+		batchSize:   100,
+		reportEvery: 10 * time.Second,
+		loggr:       slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// ReplayStats sums up a replay.
+type ReplayStats struct {
+	// Records and Batches count what the processor handled, and
+	// Skipped the records before the checkpoint the replay resumed at
+	Records int
+	Batches int
+	Skipped int
+	// Checkpoints counts the checkpoints saved, and RejectedCheckpoints
+	// those answered with an error
+	Checkpoints         int
+	RejectedCheckpoints int
+	// Last is the last checkpoint saved
+	Last    *Checkpoint
+	Elapsed time.Duration
+}
+
+// RecordsPerSecond returns the replay's throughput.
+func (s ReplayStats) RecordsPerSecond() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Records) / s.Elapsed.Seconds()
+}
+
+// LogValue logs the stats as a group.
+func (s ReplayStats) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.Int("records", s.Records),
+		slog.Int("batches", s.Batches),
+		slog.Int("skipped", s.Skipped),
+		slog.Int("checkpoints", s.Checkpoints),
+		slog.Int("rejected_checkpoints", s.RejectedCheckpoints),
+		slog.Duration("elapsed", s.Elapsed),
+		slog.String("records_per_second", fmt.Sprintf("%.1f", s.RecordsPerSecond())),
+	}
+	if s.Last != nil {
+		attrs = append(attrs, slog.String("checkpoint", s.Last.SequenceNumber))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// Run replays the records until they run out, the processor fails or
+// ctx is cancelled, in which case the processor gets shutdownRequested.
+// The stats are returned either way, an error names the batch the
+// processor failed on.
+func (r *Replay) Run(ctx context.Context) (stats ReplayStats, err error) {
+	start := time.Now()
+	defer func() { stats.Elapsed = time.Since(start) }()
+	if r.batchSize < 1 {
+		return stats, fmt.Errorf("batch size must be at least 1")
+	}
+
+	cp, resume := r.store.Get(r.shardId)
+	if resume && cp.ShardEnd {
+		r.loggr.Info("records were already replayed to the end of the shard", "shard_id", r.shardId)
+		return stats, nil
+	}
+	var pending *actions.Record
+	if resume {
+		pending, stats.Skipped, err = r.skip(cp)
+		if err != nil {
+			return stats, err
+		}
+		stats.Last = &cp
+		if pending == nil {
+			r.loggr.Info("every record was already replayed", "sequence_number", cp.SequenceNumber)
+			return stats, nil
+		}
+		r.loggr.Info("resuming after checkpoint", "sequence_number", cp.SequenceNumber, "skipped", stats.Skipped)
+	}
+
+	// current is the last batch delivered, which checkpoints must refer
+	// to
+	var current []actions.Record
+	var stderr io.Writer
+	var prefixed *prefixio.Writer
+	if r.stderr != nil {
+		prefixed = prefixio.NewWriter(r.stderr, &sync.Mutex{}, fmt.Sprintf("[%s] ", r.shardId))
+		stderr = prefixed
+	}
+	proc, err := StartProcess(context.WithoutCancel(ctx), r.command, stderr, r.checkpointer(&current, &stats))
+	if err != nil {
+		return stats, err
+	}
+	defer func() {
+		closeErr := proc.Close()
+		if prefixed != nil {
+			prefixed.Flush()
+		}
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	seqNum, subSeqNum := TrimHorizon, 0
+	if resume {
+		seqNum, subSeqNum = cp.SequenceNumber, cp.SubSequenceNumber
+	}
+	err = proc.Initialize(r.shardId, seqNum, subSeqNum)
+	if err != nil {
+		return stats, err
+	}
+
+	lastReport := time.Now()
+	for {
+		if ctx.Err() != nil {
+			r.loggr.Info("shutdown requested")
+			return stats, proc.ShutdownRequested()
+		}
+		batch, err := r.nextBatch(pending)
+		pending = nil
+		if err != nil {
+			return stats, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		current = batch
+		err = proc.ProcessRecords(batch, 0)
+		if err != nil {
+			return stats, fmt.Errorf("batch %d, records %s to %s: %w", stats.Batches+1, batch[0].SequenceNumber, batch[len(batch)-1].SequenceNumber, err)
+		}
+		stats.Batches++
+		stats.Records += len(batch)
+		if time.Since(lastReport) >= r.reportEvery {
+			lastReport = time.Now()
+			stats.Elapsed = time.Since(start)
+			r.loggr.Info("replay progress", "stats", stats)
+		}
+	}
+
+	if r.shardEnd {
+		return stats, proc.ShardEnded()
+	}
+	return stats, proc.ShutdownRequested()
+}
+
+// skip reads past the records up to cp, returning the first record
+// after it.
+func (r *Replay) skip(cp Checkpoint) (*actions.Record, int, error) {
+	skipped := 0
+	found := false
+	for {
+		rec, err := r.records.Next()
+		if errors.Is(err, io.EOF) && found {
+			return nil, skipped, nil
+		}
+		if errors.Is(err, io.EOF) {
+			return nil, skipped, fmt.Errorf("checkpoint at sequence number %s is not in the records", cp.SequenceNumber)
+		}
+		if err != nil {
+			return nil, skipped, err
+		}
+		if c, ok := cp.compare(rec); ok && c <= 0 {
+			found = true
+		} else if found {
+			return &rec, skipped, nil
+		}
+		skipped++
+	}
+}
+
+// nextBatch reads the next batch, starting with pending if it is set.
+// It is empty once the records run out.
+func (r *Replay) nextBatch(pending *actions.Record) ([]actions.Record, error) {
+	batch := make([]actions.Record, 0, r.batchSize)
+	if pending != nil {
+		batch = append(batch, *pending)
+	}
+	for len(batch) < r.batchSize {
+		rec, err := r.records.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return batch, err
+		}
+		batch = append(batch, rec)
+	}
+	return batch, nil
+}
+
+// checkpointer saves the processor's checkpoints, rejecting those for
+// records that are not in the last batch delivered.
+func (r *Replay) checkpointer(batch *[]actions.Record, stats *ReplayStats) CheckpointFunc {
+	return func(cp Checkpoint) error {
+		if !cp.ShardEnd && !inBatch(*batch, cp) {
+			stats.RejectedCheckpoints++
+			r.loggr.Warn("rejected checkpoint for a record outside the current batch", "sequence_number", cp.SequenceNumber)
+			return ErrInvalidState
+		}
+		err := r.store.Set(r.shardId, cp)
+		if err != nil {
+			stats.RejectedCheckpoints++
+			r.loggr.Error("error saving checkpoint", "error", err)
+			return ErrThrottling
+		}
+		stats.Checkpoints++
+		stats.Last = &cp
+		return nil
+	}
+}
+
+// inBatch reports whether cp is within the records of batch: at or
+// after one of them, and at or before one of them, so skip resumes
+// from it at the next record delivered.
+func inBatch(batch []actions.Record, cp Checkpoint) bool {
+	after, before := false, false
+	for _, rec := range batch {
+		if c, ok := cp.compare(rec); ok {
+			after = after || c <= 0
+			before = before || c >= 0
+		}
+	}
+	return after && before
+}
@@ -0,0 +1,151 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var quietReplay = WithReplayLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+func lines(t *testing.T, s string) *RecordReader {
+	rr, err := NewRecordReader(strings.NewReader(s), FormatLines)
+	assert.NoError(t, err)
+	return rr
+}
+
+func TestReplay(t *testing.T) {
+	t.Run("replays records in batches", func(t *testing.T) {
+		stderr := &bytes.Buffer{}
+		store := openStore(t)
+		r := NewReplay(testProcessor(t, "checkpoint"), lines(t, "a\nb\nc\nd\ne\n"), store,
+			WithReplayBatchSize(2), WithReplayStderr(stderr), quietReplay)
+
+		stats, err := r.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 5, stats.Records)
+		assert.Equal(t, 3, stats.Batches)
+		assert.Equal(t, 4, stats.Checkpoints) // every batch, and on shutdown
+		assert.Positive(t, stats.RecordsPerSecond())
+		perShard, _ := processed(stderr.String())
+		assert.Equal(t, []string{"a", "b", "c", "d", "e"}, perShard["shardId-000000000000"])
+		cp, _ := store.Get("shardId-000000000000")
+		assert.Equal(t, SequenceNumber(5), cp.SequenceNumber)
+	})
+
+	t.Run("reports failure and resumes after last checkpoint", func(t *testing.T) {
+		stderr := &bytes.Buffer{}
+		store := openStore(t)
+		records := "a\nb\nc\nfail\ne\n"
+		r := NewReplay(testProcessor(t, "fail"), lines(t, records), store,
+			WithReplayBatchSize(3), WithReplayStderr(stderr), quietReplay)
+
+		stats, err := r.Run(context.Background())
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		assert.ErrorContains(t, err, "batch 2, records 00000000000000000004 to 00000000000000000005")
+		assert.Equal(t, 3, stats.Records)
+		assert.Equal(t, 1, stats.Batches)
+		assert.Equal(t, SequenceNumber(3), stats.Last.SequenceNumber)
+
+		// the record is fixed, the replay picks up where it failed
+		stderr.Reset()
+		r = NewReplay(testProcessor(t, "fail"), lines(t, strings.Replace(records, "fail", "d", 1)), store,
+			WithReplayBatchSize(3), WithReplayStderr(stderr), quietReplay)
+		stats, err = r.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 3, stats.Skipped)
+		assert.Equal(t, 2, stats.Records)
+		perShard, _ := processed(stderr.String())
+		assert.Equal(t, []string{"d", "e"}, perShard["shardId-000000000000"])
+
+		// nothing is left to replay, so no processor is started
+		stats, err = NewReplay("does-not-exist", lines(t, strings.Replace(records, "fail", "d", 1)), store, quietReplay).Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 5, stats.Skipped)
+	})
+
+	t.Run("resumes within aggregated record", func(t *testing.T) {
+		stderr := &bytes.Buffer{}
+		store := openStore(t)
+		records := `{"data":"YQ==","sequenceNumber":"7","subSequenceNumber":0}
+{"data":"Yg==","sequenceNumber":"7","subSequenceNumber":1}
+{"data":"Yw==","sequenceNumber":"7","subSequenceNumber":2}
+{"data":"ZA==","sequenceNumber":"8"}
+`
+		// the first replay stops within the aggregated record
+		first := strings.Join(strings.SplitAfter(records, "\n")[:2], "")
+		rr, err := NewRecordReader(strings.NewReader(first), FormatRecords)
+		assert.NoError(t, err)
+		r := NewReplay(testProcessor(t, "checkpoint"), rr, store,
+			WithReplayBatchSize(2), WithReplayStderr(stderr), quietReplay)
+
+		stats, err := r.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, stats.Records)
+		cp, _ := store.Get("shardId-000000000000")
+		assert.Equal(t, Checkpoint{SequenceNumber: "7", SubSequenceNumber: 1}, cp)
+
+		stderr.Reset()
+		rr, err = NewRecordReader(strings.NewReader(records), FormatRecords)
+		assert.NoError(t, err)
+		stats, err = NewReplay(testProcessor(t, "checkpoint"), rr, store,
+			WithReplayBatchSize(2), WithReplayStderr(stderr), quietReplay).Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, stats.Skipped)
+		assert.Equal(t, 2, stats.Records)
+		perShard, _ := processed(stderr.String())
+		assert.Equal(t, []string{"c", "d"}, perShard["shardId-000000000000"])
+		assert.Zero(t, stats.RejectedCheckpoints)
+	})
+
+	t.Run("ends shard", func(t *testing.T) {
+		store := openStore(t)
+		r := NewReplay(testProcessor(t, "checkpoint"), lines(t, "a\nb\n"), store,
+			WithReplayShardEnd(true), WithReplayShardId("shardId-000000000007"), quietReplay)
+
+		_, err := r.Run(context.Background())
+		assert.NoError(t, err)
+		cp, _ := store.Get("shardId-000000000007")
+		assert.True(t, cp.ShardEnd)
+
+		stats, err := NewReplay(testProcessor(t, "checkpoint"), lines(t, "a\nb\n"), store,
+			WithReplayShardId("shardId-000000000007"), quietReplay).Run(context.Background())
+		assert.NoError(t, err)
+		assert.Zero(t, stats.Records)
+	})
+
+	t.Run("rejects checkpoint not in records", func(t *testing.T) {
+		store := openStore(t)
+		assert.NoError(t, store.Set("shardId-000000000000", Checkpoint{SequenceNumber: SequenceNumber(9)}))
+		_, err := NewReplay(testProcessor(t, "checkpoint"), lines(t, "a\nb\n"), store, quietReplay).Run(context.Background())
+		assert.EqualError(t, err, "checkpoint at sequence number 00000000000000000009 is not in the records")
+	})
+
+	t.Run("shuts down when cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		stats, err := NewReplay(testProcessor(t, "checkpoint"), lines(t, "a\nb\n"), openStore(t), quietReplay).Run(ctx)
+		assert.NoError(t, err)
+		assert.Zero(t, stats.Records)
+	})
+}
+
+func TestInBatch(t *testing.T) {
+	batch := GenerateRecords(4)
+	seq := SequenceNumber(9)
+	for i := 1; i < 4; i++ {
+		batch[i].SequenceNumber = seq
+		batch[i].SubSequenceNumber = i
+	}
+	assert.True(t, inBatch(batch, Checkpoint{SequenceNumber: batch[0].SequenceNumber}))
+	assert.True(t, inBatch(batch, Checkpoint{SequenceNumber: seq, SubSequenceNumber: 1}))
+	assert.True(t, inBatch(batch, Checkpoint{SequenceNumber: seq, SubSequenceNumber: 3}))
+	assert.False(t, inBatch(batch, Checkpoint{SequenceNumber: seq}), "before the first sub sequence number delivered")
+	assert.False(t, inBatch(batch, Checkpoint{SequenceNumber: seq, SubSequenceNumber: 4}))
+	assert.False(t, inBatch(batch, Checkpoint{SequenceNumber: SequenceNumber(3)}))
+}
@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store keeps the last checkpoint of every shard in a json file, so a
+// restarted run resumes where the last one stopped. It is safe for
+// concurrent use.
+type Store struct {
+	mu          sync.Mutex
+	path        string
+	checkpoints map[string]Checkpoint
+}
+
+// OpenStore opens the store at path, reading the checkpoints saved
+// there if the file exists.
+func OpenStore(path string) (*Store, error) {
+	s := &Store{path: path, checkpoints: map[string]Checkpoint{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &s.checkpoints)
+	if err != nil {
+		return nil, fmt.Errorf("error reading checkpoints from %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Get returns the last checkpoint of shardId, and false if it has none.
+func (s *Store) Get(shardId string) (Checkpoint, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, ok := s.checkpoints[shardId]
+	return cp, ok
+}
+
+// Set saves cp as the last checkpoint of shardId. The file is replaced
+// atomically, so a crash never leaves it half written, and Get only
+// returns cp once it is written.
+func (s *Store) Set(shardId string, cp Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checkpoints := maps.Clone(s.checkpoints)
+	checkpoints[shardId] = cp
+	b, err := json.MarshalIndent(checkpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.path), 0o755)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	err = os.WriteFile(tmp, append(b, '\n'), 0o644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, s.path)
+	if err != nil {
+		return err
+	}
+	s.checkpoints = checkpoints
+	return nil
+}
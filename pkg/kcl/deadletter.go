@@ -0,0 +1,167 @@
+package kcl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+)
+
+// RecordError ties a processing error to the specific record that
+// caused it. Returning a RecordError (or an error wrapping one) from
+// `ProcessRecords` lets Manager's dead letter policy retry or route
+// just that record instead of failing the whole shard.
+type RecordError struct {
+	Record actions.Record
+	Err    error
+}
+
+// NewRecordError wraps err with the record that could not be processed.
+func NewRecordError(r actions.Record, err error) error {
+	return &RecordError{Record: r, Err: err}
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("error processing record <%s/%d>: %v", e.Record.SequenceNumber, e.Record.SubSequenceNumber, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// DeadLetter is a poison record handed to a DeadLetterSink along with
+// the context of why and where it failed.
+type DeadLetter struct {
+	ShardId  string
+	Record   actions.Record
+	Err      error
+	Attempts int
+}
+
+// MarshalJSON encodes the dead letter as a single json object. The
+// error is flattened to its message so the output can be read back
+// without any knowledge of the original error type.
+func (dl DeadLetter) MarshalJSON() ([]byte, error) {
+	var errMsg string
+	if dl.Err != nil {
+		errMsg = dl.Err.Error()
+	}
+	return json.Marshal(struct {
+		ShardId  string         `json:"shardId"`
+		Record   actions.Record `json:"record"`
+		Error    string         `json:"error"`
+		Attempts int            `json:"attempts"`
+	}{
+		ShardId:  dl.ShardId,
+		Record:   dl.Record,
+		Error:    errMsg,
+		Attempts: dl.Attempts,
+	})
+}
+
+// DeadLetterSink receives records that could not be processed. Manager
+// only moves on to the records after a dead letter once Send returns
+// without error, so implementations should not return until the dead
+// letter is durably stored.
+type DeadLetterSink interface {
+	Send(dl DeadLetter) error
+}
+
+// DeadLetterPolicy configures how Manager handles a RecordError
+// returned from `ProcessRecords`. The failing record is retried (along
+// with the rest of the batch after it) until it has been attempted
+// MaxAttempts times, after which it is sent to Sink and processing
+// continues with the next record.
+type DeadLetterPolicy struct {
+	Sink        DeadLetterSink
+	MaxAttempts int
+}
+
+// FileDeadLetterSink appends dead letters to a local file as newline
+// delimited json, syncing the file after every write.
+type FileDeadLetterSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileDeadLetterSink opens (or creates) the file at path for
+// appending dead letters.
+func NewFileDeadLetterSink(path string) (*FileDeadLetterSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening dead letter file: %v", err)
+	}
+	return &FileDeadLetterSink{file: f}, nil
+}
+
+func (s *FileDeadLetterSink) Send(dl DeadLetter) error {
+	line, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(line)
+	if err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close closes the underlying file.
+func (s *FileDeadLetterSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// HTTPDeadLetterSink POSTs each dead letter as a json object to an
+// HTTP endpoint. Any non 2xx response is treated as a failed write.
+type HTTPDeadLetterSink struct {
+	url    string
+	client *http.Client
+}
+
+type HTTPDeadLetterSinkOpts func(s *HTTPDeadLetterSink)
+
+// NewHTTPDeadLetterSink creates a sink posting to url. By default
+// requests time out after 10 seconds.
+func NewHTTPDeadLetterSink(url string, opts ...HTTPDeadLetterSinkOpts) *HTTPDeadLetterSink {
+	s := &HTTPDeadLetterSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func WithHTTPClient(c *http.Client) HTTPDeadLetterSinkOpts {
+	return func(s *HTTPDeadLetterSink) {
+		s.client = c
+	}
+}
+
+func (s *HTTPDeadLetterSink) Send(dl DeadLetter) error {
+	body, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error posting dead letter: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("dead letter endpoint responded with status: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package kcl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+// poisonRecordProcessor fails with a RecordError on every record whose
+// sequence number is in poison, and records every sequence number it
+// successfully processed.
+type poisonRecordProcessor struct {
+	MockRecordProcessor
+	poison    map[string]bool
+	processed []string
+	calls     int
+}
+
+func (p *poisonRecordProcessor) ProcessRecords(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+	p.calls++
+	for _, r := range records {
+		if p.poison[r.SequenceNumber] {
+			return NewRecordError(r, errors.New("poison"))
+		}
+		p.processed = append(p.processed, r.SequenceNumber)
+	}
+	return nil
+}
+
+type recordingSink struct {
+	sent []DeadLetter
+	err  error
+}
+
+func (s *recordingSink) Send(dl DeadLetter) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, dl)
+	return nil
+}
+
+func testProcessAction(seqNums ...string) actions.ProcessAction {
+	pa := actions.ProcessAction{Action: actions.PROCESS_RECORDS}
+	for _, sn := range seqNums {
+		pa.Records = append(pa.Records, actions.Record{SequenceNumber: sn, Data: "ZGF0YQ=="})
+	}
+	return pa
+}
+
+func TestDeadLetterPolicy(t *testing.T) {
+	t.Run("sends poison record to sink and continues", func(t *testing.T) {
+		processor := &poisonRecordProcessor{poison: map[string]bool{"2": true}}
+		sink := &recordingSink{}
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, processor, WithDeadLetterPolicy(DeadLetterPolicy{Sink: sink, MaxAttempts: 3}))
+		manager.shardId = "shard-1"
+
+		err := manager.processRecords(actions.RawAction{ActionType: actions.PROCESS_RECORDS}, testProcessAction("1", "2", "3"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1", "3"}, processor.processed)
+		// first call plus two retries, then the call for the remainder
+		assert.Equal(t, 4, processor.calls)
+		if assert.Len(t, sink.sent, 1) {
+			assert.Equal(t, "shard-1", sink.sent[0].ShardId)
+			assert.Equal(t, "2", sink.sent[0].Record.SequenceNumber)
+			assert.Equal(t, 3, sink.sent[0].Attempts)
+			assert.EqualError(t, sink.sent[0].Err, "poison")
+		}
+	})
+
+	t.Run("does not continue past record when sink fails", func(t *testing.T) {
+		processor := &poisonRecordProcessor{poison: map[string]bool{"2": true}}
+		sink := &recordingSink{err: errors.New("sink down")}
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, processor, WithDeadLetterPolicy(DeadLetterPolicy{Sink: sink}))
+
+		err := manager.processRecords(actions.RawAction{ActionType: actions.PROCESS_RECORDS}, testProcessAction("1", "2", "3"))
+		assert.Error(t, err)
+		assert.Equal(t, []string{"1"}, processor.processed)
+	})
+
+	t.Run("returns record error without policy", func(t *testing.T) {
+		processor := &poisonRecordProcessor{poison: map[string]bool{"1": true}}
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, processor)
+
+		err := manager.processRecords(actions.RawAction{ActionType: actions.PROCESS_RECORDS}, testProcessAction("1", "2"))
+		var recErr *RecordError
+		assert.ErrorAs(t, err, &recErr)
+		assert.Empty(t, processor.processed)
+	})
+
+	t.Run("returns plain errors unchanged", func(t *testing.T) {
+		processor := new(MockRecordProcessor)
+		processor.ProcessRecordsError = errors.New("batch failed")
+		sink := &recordingSink{}
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, processor, WithDeadLetterPolicy(DeadLetterPolicy{Sink: sink}))
+
+		err := manager.processRecords(actions.RawAction{ActionType: actions.PROCESS_RECORDS}, testProcessAction("1"))
+		assert.EqualError(t, err, "batch failed")
+		assert.Empty(t, sink.sent)
+	})
+}
+
+func TestFileDeadLetterSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dlq.ndjson")
+	sink, err := NewFileDeadLetterSink(path)
+	assert.NoError(t, err)
+
+	assert.NoError(t, sink.Send(DeadLetter{ShardId: "shard-1", Record: actions.Record{SequenceNumber: "1"}, Err: errors.New("bad"), Attempts: 1}))
+	assert.NoError(t, sink.Send(DeadLetter{ShardId: "shard-1", Record: actions.Record{SequenceNumber: "2"}, Err: errors.New("worse"), Attempts: 2}))
+	assert.NoError(t, sink.Close())
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line map[string]any
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, "worse", lines[1]["error"])
+		assert.Equal(t, float64(2), lines[1]["attempts"])
+		assert.Equal(t, "2", lines[1]["record"].(map[string]any)["sequenceNumber"])
+	}
+}
+
+func TestHTTPDeadLetterSink(t *testing.T) {
+	t.Run("posts dead letter as json", func(t *testing.T) {
+		var got map[string]any
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer srv.Close()
+
+		sink := NewHTTPDeadLetterSink(srv.URL)
+		err := sink.Send(DeadLetter{ShardId: "shard-1", Record: actions.Record{SequenceNumber: "1"}, Err: errors.New("bad"), Attempts: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, "shard-1", got["shardId"])
+		assert.Equal(t, "bad", got["error"])
+	})
+
+	t.Run("treats non 2xx as failure", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		sink := NewHTTPDeadLetterSink(srv.URL)
+		err := sink.Send(DeadLetter{})
+		assert.Error(t, err)
+	})
+}
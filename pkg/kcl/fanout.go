@@ -0,0 +1,212 @@
+package kcl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+)
+
+// position is a point in the shard a child processor has checkpointed.
+type position struct {
+	seqNum    string
+	subSeqNum *int
+	// shardEnd is set when a child checkpoints the end of the shard
+	// during ShardEnded
+	shardEnd bool
+}
+
+// comparePositions orders positions by sequence number, then sub
+// sequence number. Sequence numbers are arbitrarily large decimal
+// strings so they are compared by length first. A missing sub sequence
+// number is treated as 0, the same as KCL does.
+func comparePositions(a, b position) int {
+	if a.shardEnd != b.shardEnd {
+		if a.shardEnd {
+			return 1
+		}
+		return -1
+	}
+	if len(a.seqNum) != len(b.seqNum) {
+		if len(a.seqNum) < len(b.seqNum) {
+			return -1
+		}
+		return 1
+	}
+	if c := strings.Compare(a.seqNum, b.seqNum); c != 0 {
+		return c
+	}
+	var aSub, bSub int
+	if a.subSeqNum != nil {
+		aSub = *a.subSeqNum
+	}
+	if b.subSeqNum != nil {
+		bSub = *b.subSeqNum
+	}
+	switch {
+	case aSub < bSub:
+		return -1
+	case aSub > bSub:
+		return 1
+	}
+	return 0
+}
+
+// FanOut is a RecordProcessor delivering every batch to a set of child
+// RecordProcessors, so several independent consumers (e.g. an archiver
+// and an indexer) can share one KCL application and child process.
+//
+// Children are handed their own Checkpointer which does not talk to KCL
+// but records how far that child has acknowledged. After every lifecycle
+// call FanOut checkpoints the minimum position acknowledged by all
+// children through the real Checkpointer, so no child ever has records
+// checkpointed out from under it. Children are called one after the
+// other in the order they were given, and errors from all of them are
+// joined together.
+type FanOut struct {
+	children []RecordProcessor
+	acked    []*position
+	// delivered is the last record of the latest batch, which is what a
+	// child's CheckpointBatch refers to
+	delivered    position
+	checkpointed *position
+}
+
+// NewFanOut creates a FanOut delivering to children.
+func NewFanOut(children ...RecordProcessor) *FanOut {
+	return &FanOut{
+		children: children,
+		acked:    make([]*position, len(children)),
+	}
+}
+
+// childCheckpointer returns the Checkpointer handed to child i. When
+// shardEnded is true a CheckpointBatch marks the end of the shard.
+func (f *FanOut) childCheckpointer(i int, shardEnded bool) *checkpoint.Checkpointer {
+	return checkpoint.NewCheckpointerFunc(func(seqNum *string, subSeqNum *int) error {
+		var p position
+		switch {
+		case seqNum == nil && shardEnded:
+			p = position{shardEnd: true}
+		case seqNum == nil:
+			p = f.delivered
+		default:
+			p = position{seqNum: *seqNum, subSeqNum: subSeqNum}
+		}
+		f.acked[i] = &p
+		return nil
+	})
+}
+
+// forward calls fn for every child, joining their errors.
+func (f *FanOut) forward(fn func(i int, child RecordProcessor) error) error {
+	var errs []error
+	for i, child := range f.children {
+		err := fn(i, child)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("fan out child %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkpointMin checkpoints the minimum position acknowledged by every
+// child if it is past what was last checkpointed.
+func (f *FanOut) checkpointMin(cp *checkpoint.Checkpointer) error {
+	var lowest *position
+	for _, p := range f.acked {
+		if p == nil {
+			// a child that has not checkpointed holds everyone back
+			return nil
+		}
+		if lowest == nil || comparePositions(*p, *lowest) < 0 {
+			lowest = p
+		}
+	}
+	if lowest == nil {
+		return nil
+	}
+	if f.checkpointed != nil && comparePositions(*lowest, *f.checkpointed) <= 0 {
+		return nil
+	}
+
+	var err error
+	switch {
+	case lowest.shardEnd:
+		err = cp.CheckpointBatch()
+	case lowest.subSeqNum != nil:
+		err = cp.CheckpointSubSeqNum(lowest.seqNum, *lowest.subSeqNum)
+	default:
+		err = cp.CheckpointSeqNum(lowest.seqNum)
+	}
+	if err != nil {
+		return err
+	}
+	checkpointed := *lowest
+	f.checkpointed = &checkpointed
+	return nil
+}
+
+func (f *FanOut) Initialize(shardId, seqNum string, subSeqNum int) error {
+	f.acked = make([]*position, len(f.children))
+	f.delivered = position{}
+	f.checkpointed = nil
+	return f.forward(func(i int, child RecordProcessor) error {
+		return child.Initialize(shardId, seqNum, subSeqNum)
+	})
+}
+
+func (f *FanOut) ProcessRecords(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+	if len(records) > 0 {
+		last := records[len(records)-1]
+		f.delivered = position{seqNum: last.SequenceNumber, subSeqNum: &last.SubSequenceNumber}
+	}
+	err := f.forward(func(i int, child RecordProcessor) error {
+		return child.ProcessRecords(records, lag, f.childCheckpointer(i, false))
+	})
+	return errors.Join(err, f.checkpointMin(cp))
+}
+
+func (f *FanOut) LeaseLost() error {
+	return f.forward(func(i int, child RecordProcessor) error {
+		return child.LeaseLost()
+	})
+}
+
+// ShardEnded forwards to every child. The end of the shard is only
+// checkpointed once every child has called CheckpointBatch.
+func (f *FanOut) ShardEnded(cp *checkpoint.Checkpointer) error {
+	err := f.forward(func(i int, child RecordProcessor) error {
+		return child.ShardEnded(f.childCheckpointer(i, true))
+	})
+	return errors.Join(err, f.checkpointMin(cp))
+}
+
+func (f *FanOut) ShutdownRequested(cp *checkpoint.Checkpointer) error {
+	err := f.forward(func(i int, child RecordProcessor) error {
+		return child.ShutdownRequested(f.childCheckpointer(i, false))
+	})
+	return errors.Join(err, f.checkpointMin(cp))
+}
+
+// SetLogger hands l to every child implementing LoggerSetter.
+func (f *FanOut) SetLogger(l *slog.Logger) {
+	for i, child := range f.children {
+		if ls, ok := child.(LoggerSetter); ok {
+			ls.SetLogger(l.With("fan_out_child", i))
+		}
+	}
+}
+
+// SetContext hands ctx to every child implementing ContextSetter.
+func (f *FanOut) SetContext(ctx context.Context) {
+	for _, child := range f.children {
+		if cs, ok := child.(ContextSetter); ok {
+			cs.SetContext(ctx)
+		}
+	}
+}
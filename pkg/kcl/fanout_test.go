@@ -0,0 +1,113 @@
+package kcl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanOut(t *testing.T) {
+	t.Run("checkpoints minimum acknowledged position", func(t *testing.T) {
+		archiver := &RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				return cp.CheckpointBatch()
+			},
+		}
+		indexer := &RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				// lags one record behind the archiver
+				return cp.CheckpointSeqNum(records[len(records)-2].SequenceNumber)
+			},
+		}
+
+		mockReader := bytes.NewBufferString(strings.Repeat(checkpointAck, 2))
+		mockWriter := &bytes.Buffer{}
+		manager := NewManager(mockReader, mockWriter, NewFanOut(archiver, indexer))
+
+		actionBytes, _ := json.Marshal(testProcessAction("100", "101", "102"))
+		rAction, err := actions.NewRawAction(string(actionBytes))
+		assert.NoError(t, err)
+		assert.NoError(t, manager.processRawAction(rAction))
+
+		// the indexer catches up on shutdown
+		rAction, err = actions.NewRawAction(`{"action":"shutdownRequested"}`)
+		assert.NoError(t, err)
+		assert.NoError(t, manager.processRawAction(rAction))
+
+		dec := json.NewDecoder(mockWriter)
+		var first, second map[string]any
+		assert.NoError(t, dec.Decode(&first))
+		assert.NoError(t, dec.Decode(&second))
+		assert.Equal(t, map[string]any{"action": "checkpoint", "sequenceNumber": "101"}, first)
+		assert.Equal(t, map[string]any{"action": "checkpoint", "sequenceNumber": "102", "subSequenceNumber": float64(0)}, second)
+	})
+
+	t.Run("does not checkpoint until every child has", func(t *testing.T) {
+		eager := &RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				return cp.CheckpointBatch()
+			},
+		}
+		lazy := &RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				return nil
+			},
+		}
+
+		mockWriter := &bytes.Buffer{}
+		manager := NewManager(&bytes.Buffer{}, mockWriter, NewFanOut(eager, lazy))
+
+		actionBytes, _ := json.Marshal(testProcessAction("1", "2"))
+		rAction, err := actions.NewRawAction(string(actionBytes))
+		assert.NoError(t, err)
+		assert.NoError(t, manager.processRawAction(rAction))
+		assert.Empty(t, mockWriter.String())
+	})
+
+	t.Run("checkpoints shard end once every child has", func(t *testing.T) {
+		mockReader := bytes.NewBufferString(checkpointAck)
+		mockWriter := &bytes.Buffer{}
+		// RecordProcessorFuncs checkpoints the batch on shard end by default
+		manager := NewManager(mockReader, mockWriter, NewFanOut(&RecordProcessorFuncs{}, &RecordProcessorFuncs{}))
+
+		rAction, err := actions.NewRawAction(`{"action":"shardEnded"}`)
+		assert.NoError(t, err)
+		assert.NoError(t, manager.processRawAction(rAction))
+		assert.JSONEq(t, `{"action":"checkpoint"}`, mockWriter.String())
+	})
+
+	t.Run("forwards lifecycle calls and joins errors", func(t *testing.T) {
+		first := new(MockRecordProcessor)
+		first.LeaseLostError = errors.New("first failed")
+		second := new(MockRecordProcessor)
+		third := new(MockRecordProcessor)
+		third.LeaseLostError = errors.New("third failed")
+
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, NewFanOut(first, second, third))
+
+		rAction, err := actions.NewRawAction(`{"action":"leaseLost"}`)
+		assert.NoError(t, err)
+
+		err = manager.processRawAction(rAction)
+		assert.ErrorIs(t, err, first.LeaseLostError)
+		assert.ErrorIs(t, err, third.LeaseLostError)
+		assert.True(t, first.LeaseLostCalled)
+		assert.True(t, second.LeaseLostCalled)
+		assert.True(t, third.LeaseLostCalled)
+	})
+}
+
+func TestComparePositions(t *testing.T) {
+	one, two := 1, 2
+	assert.Equal(t, -1, comparePositions(position{seqNum: "9"}, position{seqNum: "10"}))
+	assert.Equal(t, 1, comparePositions(position{seqNum: "20"}, position{seqNum: "19"}))
+	assert.Equal(t, -1, comparePositions(position{seqNum: "5", subSeqNum: &one}, position{seqNum: "5", subSeqNum: &two}))
+	assert.Equal(t, 0, comparePositions(position{seqNum: "5"}, position{seqNum: "5", subSeqNum: new(int)}))
+	assert.Equal(t, 1, comparePositions(position{shardEnd: true}, position{seqNum: "5"}))
+}
@@ -0,0 +1,129 @@
+package kcl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/kcltest/faultio"
+	"github.com/stretchr/testify/assert"
+)
+
+func batchCheckpointer() *RecordProcessorFuncs {
+	return &RecordProcessorFuncs{
+		ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+			return cp.CheckpointBatch()
+		},
+	}
+}
+
+// sentMessages summarizes the messages in out as "<action> <responseFor>".
+func sentMessages(t *testing.T, out string) []string {
+	var sent []string
+	dec := json.NewDecoder(bytes.NewBufferString(out))
+	for dec.More() {
+		var msg struct {
+			Action      string `json:"action"`
+			ResponseFor string `json:"responseFor"`
+		}
+		if !assert.NoError(t, dec.Decode(&msg)) {
+			break
+		}
+		sent = append(sent, strings.TrimSpace(msg.Action+" "+msg.ResponseFor))
+	}
+	return sent
+}
+
+func TestManagerFaults(t *testing.T) {
+	quiet := WithManagerLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	// want checks the error Start returned for each scenario
+	want := map[string]func(t *testing.T, err error, out string){
+		"clean session in random chunks": func(t *testing.T, err error, out string) {
+			assert.NoError(t, err)
+			assert.Equal(t, []string{
+				"status " + actions.INITITALIZE,
+				"checkpoint",
+				"status " + actions.PROCESS_RECORDS,
+				"checkpoint",
+				"status " + actions.SHUTDOWN_REQUESTED,
+			}, sentMessages(t, out))
+		},
+		// several messages in one read, acks and actions alike
+		"clean session in one read": func(t *testing.T, err error, out string) {
+			assert.NoError(t, err)
+			assert.Equal(t, []string{
+				"status " + actions.INITITALIZE,
+				"checkpoint",
+				"status " + actions.PROCESS_RECORDS,
+				"checkpoint",
+				"status " + actions.SHUTDOWN_REQUESTED,
+			}, sentMessages(t, out))
+		},
+		// the shutdown request is held until the batch is answered, and
+		// the ack still reaches the checkpointer
+		"shutdown requested before checkpoint ack": func(t *testing.T, err error, out string) {
+			assert.NoError(t, err)
+			assert.Equal(t, []string{
+				"status " + actions.INITITALIZE,
+				"checkpoint",
+				"status " + actions.PROCESS_RECORDS,
+				"checkpoint",
+				"status " + actions.SHUTDOWN_REQUESTED,
+			}, sentMessages(t, out))
+		},
+		"input truncated mid json": func(t *testing.T, err error, out string) {
+			assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+			assert.Contains(t, err.Error(), "error reading kcl action request")
+		},
+		"output write fails": func(t *testing.T, err error, out string) {
+			assert.ErrorIs(t, err, faultio.ErrInjected)
+			assert.Empty(t, out)
+		},
+		"output write fails mid message": func(t *testing.T, err error, out string) {
+			assert.ErrorIs(t, err, faultio.ErrInjected)
+			assert.Len(t, out, 10)
+		},
+		// the daemon going away while the processor waits for an ack
+		// leaves the batch unanswered
+		"eof during processRecords": func(t *testing.T, err error, out string) {
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Contains(t, out, `"action":"checkpoint"`)
+			assert.NotContains(t, out, `"responseFor":"processRecords"`)
+		},
+		"malformed checkpoint ack": func(t *testing.T, err error, out string) {
+			var invalidErr *checkpoint.InvalidAckError
+			assert.ErrorAs(t, err, &invalidErr)
+		},
+	}
+	for _, seed := range []int64{1, 2, 3} {
+		for _, s := range faultio.Scenarios(seed) {
+			t.Run(fmt.Sprintf("%s/seed %d", s.Name, seed), func(t *testing.T) {
+				check, ok := want[s.Name]
+				if !assert.True(t, ok, "no expectation for scenario") {
+					return
+				}
+				out := &bytes.Buffer{}
+				i, o := s.Streams(out)
+				err := NewManager(i, o, batchCheckpointer(), quiet).Start()
+				check(t, err, out.String())
+			})
+		}
+	}
+
+	t.Run("malformed checkpoint acks", func(t *testing.T) {
+		for name, ack := range faultio.MalformedAcks {
+			t.Run(name, func(t *testing.T) {
+				i := faultio.Lines(faultio.Initialize, faultio.ProcessRecords, ack)
+				err := NewManager(i, &bytes.Buffer{}, batchCheckpointer(), quiet).Start()
+				var invalidErr *checkpoint.InvalidAckError
+				assert.ErrorAs(t, err, &invalidErr)
+			})
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package kcl
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+)
+
+// RecordProcessorFuncs implements RecordProcessor with a set of
+// optional functions, so a simple consumer only has to write the parts
+// it cares about. Any function left nil falls back to a safe default:
+//
+//   - Initialize does nothing.
+//   - ProcessRecords returns an error, since there is no sensible way to
+//     consume records without being told how.
+//   - LeaseLost does nothing. Checkpointing is not possible once the
+//     lease is lost.
+//   - ShardEnded calls `cp.CheckpointBatch()`, which KCL requires before
+//     it can clean up the lease of an ended shard.
+//   - ShutdownRequested checkpoints the last record successfully
+//     processed (see LastProcessed), or does nothing if no record has
+//     been processed yet.
+//
+// RecordProcessorFuncs must be used as a pointer so it can keep track of
+// the last processed record.
+type RecordProcessorFuncs struct {
+	InitializeFunc        func(shardId, seqNum string, subSeqNum int) error
+	ProcessRecordsFunc    func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error
+	LeaseLostFunc         func() error
+	ShardEndedFunc        func(cp *checkpoint.Checkpointer) error
+	ShutdownRequestedFunc func(cp *checkpoint.Checkpointer) error
+
+	// lastProcessed is a copy rather than a pointer into the batch so
+	// the rest of the batch can be garbage collected
+	lastProcessed    actions.Record
+	hasLastProcessed bool
+	loggr            *slog.Logger
+	ctx              context.Context
+}
+
+// ErrNoProcessRecordsFunc is returned by RecordProcessorFuncs when it is
+// asked to process records without a ProcessRecordsFunc.
+var ErrNoProcessRecordsFunc = errors.New("no ProcessRecordsFunc configured")
+
+func (f *RecordProcessorFuncs) Initialize(shardId, seqNum string, subSeqNum int) error {
+	if f.InitializeFunc == nil {
+		return nil
+	}
+	return f.InitializeFunc(shardId, seqNum, subSeqNum)
+}
+
+// ProcessRecords calls ProcessRecordsFunc and tracks the last record it
+// processed. A nil error marks the whole batch as processed. A
+// RecordError marks every record before the failed one as processed.
+// Any other error leaves the last processed record unchanged.
+func (f *RecordProcessorFuncs) ProcessRecords(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+	if f.ProcessRecordsFunc == nil {
+		return ErrNoProcessRecordsFunc
+	}
+	err := f.ProcessRecordsFunc(records, lag, cp)
+	if err == nil {
+		if len(records) > 0 {
+			f.setLastProcessed(records[len(records)-1])
+		}
+		return nil
+	}
+	var recErr *RecordError
+	if errors.As(err, &recErr) {
+		idx := recordIndex(records, recErr.Record)
+		if idx > 0 {
+			f.setLastProcessed(records[idx-1])
+		}
+	}
+	return err
+}
+
+func (f *RecordProcessorFuncs) LeaseLost() error {
+	if f.LeaseLostFunc == nil {
+		return nil
+	}
+	return f.LeaseLostFunc()
+}
+
+func (f *RecordProcessorFuncs) ShardEnded(cp *checkpoint.Checkpointer) error {
+	if f.ShardEndedFunc == nil {
+		return cp.CheckpointBatch()
+	}
+	return f.ShardEndedFunc(cp)
+}
+
+func (f *RecordProcessorFuncs) ShutdownRequested(cp *checkpoint.Checkpointer) error {
+	if f.ShutdownRequestedFunc != nil {
+		return f.ShutdownRequestedFunc(cp)
+	}
+	last, ok := f.LastProcessed()
+	if !ok {
+		return nil
+	}
+	return cp.CheckpointSubSeqNum(last.SequenceNumber, last.SubSequenceNumber)
+}
+
+// LastProcessed returns the last record ProcessRecordsFunc successfully
+// processed, and false if no record has been processed yet.
+func (f *RecordProcessorFuncs) LastProcessed() (actions.Record, bool) {
+	return f.lastProcessed, f.hasLastProcessed
+}
+
+func (f *RecordProcessorFuncs) setLastProcessed(r actions.Record) {
+	f.lastProcessed = r
+	f.hasLastProcessed = true
+}
+
+// SetLogger implements LoggerSetter so the functions can log through
+// the manager's shard scoped logger, see Logger.
+func (f *RecordProcessorFuncs) SetLogger(l *slog.Logger) {
+	f.loggr = l
+}
+
+// Logger returns the logger the manager handed over for the current
+// call, or the default logger when used without a Manager.
+func (f *RecordProcessorFuncs) Logger() *slog.Logger {
+	if f.loggr == nil {
+		return slog.Default()
+	}
+	return f.loggr
+}
+
+// SetContext implements ContextSetter so the functions can stop work
+// the manager's watchdog gave up on, see Context.
+func (f *RecordProcessorFuncs) SetContext(ctx context.Context) {
+	f.ctx = ctx
+}
+
+// Context returns the context of the current call, or a background
+// context when used without a Manager.
+func (f *RecordProcessorFuncs) Context() context.Context {
+	if f.ctx == nil {
+		return context.Background()
+	}
+	return f.ctx
+}
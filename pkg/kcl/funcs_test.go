@@ -0,0 +1,141 @@
+package kcl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+// checkpointAck is the response KCL Multilang sends after a successful
+// checkpoint.
+const checkpointAck = `{"action":"checkpoint","sequenceNumber":null,"subSequenceNumber":null,"error":""}`
+
+func TestRecordProcessorFuncs(t *testing.T) {
+	t.Run("initialize defaults to no-op", func(t *testing.T) {
+		mockWriter := &bytes.Buffer{}
+		manager := NewManager(&bytes.Buffer{}, mockWriter, &RecordProcessorFuncs{})
+
+		rAction, err := actions.NewRawAction(`{"action":"initialize","shardId":"shard-123"}`)
+		assert.NoError(t, err)
+
+		err = manager.processRawAction(rAction)
+		assert.NoError(t, err)
+		assert.Empty(t, mockWriter.String())
+	})
+
+	t.Run("process records without func returns error", func(t *testing.T) {
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, &RecordProcessorFuncs{})
+
+		actionBytes, _ := json.Marshal(testProcessAction("1"))
+		rAction, err := actions.NewRawAction(string(actionBytes))
+		assert.NoError(t, err)
+
+		err = manager.processRawAction(rAction)
+		assert.ErrorIs(t, err, ErrNoProcessRecordsFunc)
+	})
+
+	t.Run("lease lost defaults to no-op", func(t *testing.T) {
+		mockWriter := &bytes.Buffer{}
+		manager := NewManager(&bytes.Buffer{}, mockWriter, &RecordProcessorFuncs{})
+
+		rAction, err := actions.NewRawAction(`{"action":"leaseLost"}`)
+		assert.NoError(t, err)
+
+		err = manager.processRawAction(rAction)
+		assert.NoError(t, err)
+		assert.Empty(t, mockWriter.String())
+	})
+
+	t.Run("shard ended defaults to checkpoint batch", func(t *testing.T) {
+		mockReader := bytes.NewBufferString(checkpointAck)
+		mockWriter := &bytes.Buffer{}
+		manager := NewManager(mockReader, mockWriter, &RecordProcessorFuncs{})
+
+		rAction, err := actions.NewRawAction(`{"action":"shardEnded"}`)
+		assert.NoError(t, err)
+
+		err = manager.processRawAction(rAction)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"action":"checkpoint"}`, mockWriter.String())
+	})
+
+	t.Run("shutdown requested defaults to checkpoint last processed record", func(t *testing.T) {
+		mockReader := bytes.NewBufferString(checkpointAck)
+		mockWriter := &bytes.Buffer{}
+		rp := &RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				return nil
+			},
+		}
+		manager := NewManager(mockReader, mockWriter, rp)
+
+		batch := testProcessAction("1", "2")
+		batch.Records[1].SubSequenceNumber = 3
+		actionBytes, _ := json.Marshal(batch)
+		rAction, err := actions.NewRawAction(string(actionBytes))
+		assert.NoError(t, err)
+		assert.NoError(t, manager.processRawAction(rAction))
+
+		rAction, err = actions.NewRawAction(`{"action":"shutdownRequested"}`)
+		assert.NoError(t, err)
+
+		err = manager.processRawAction(rAction)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"action":"checkpoint","sequenceNumber":"2","subSequenceNumber":3}`, mockWriter.String())
+	})
+
+	t.Run("shutdown requested skips checkpoint when nothing processed", func(t *testing.T) {
+		mockWriter := &bytes.Buffer{}
+		manager := NewManager(&bytes.Buffer{}, mockWriter, &RecordProcessorFuncs{})
+
+		rAction, err := actions.NewRawAction(`{"action":"shutdownRequested"}`)
+		assert.NoError(t, err)
+
+		err = manager.processRawAction(rAction)
+		assert.NoError(t, err)
+		assert.Empty(t, mockWriter.String())
+	})
+
+	t.Run("record error marks records before it as processed", func(t *testing.T) {
+		rp := &RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				return NewRecordError(records[2], errors.New("poison"))
+			},
+		}
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, rp)
+
+		actionBytes, _ := json.Marshal(testProcessAction("1", "2", "3"))
+		rAction, err := actions.NewRawAction(string(actionBytes))
+		assert.NoError(t, err)
+
+		assert.Error(t, manager.processRawAction(rAction))
+		last, ok := rp.LastProcessed()
+		assert.True(t, ok)
+		assert.Equal(t, "2", last.SequenceNumber)
+	})
+
+	t.Run("calls provided funcs instead of defaults", func(t *testing.T) {
+		mockWriter := &bytes.Buffer{}
+		shardEndedCalled := false
+		rp := &RecordProcessorFuncs{
+			ShardEndedFunc: func(cp *checkpoint.Checkpointer) error {
+				shardEndedCalled = true
+				return nil
+			},
+		}
+		manager := NewManager(&bytes.Buffer{}, mockWriter, rp)
+
+		rAction, err := actions.NewRawAction(`{"action":"shardEnded"}`)
+		assert.NoError(t, err)
+
+		err = manager.processRawAction(rAction)
+		assert.NoError(t, err)
+		assert.True(t, shardEndedCalled)
+		assert.Empty(t, mockWriter.String())
+	})
+}
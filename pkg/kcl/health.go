@@ -0,0 +1,198 @@
+package kcl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+)
+
+// Phase is where the manager is in the KCL Multilang protocol.
+type Phase string
+
+const (
+	// PhaseStarting is before the initialize action has been handled
+	PhaseStarting Phase = "starting"
+	// PhaseIdle is between actions once the shard is initialized
+	PhaseIdle Phase = "idle"
+	// PhaseProcessing is while an action is being handled
+	PhaseProcessing Phase = "processing"
+	// PhaseShuttingDown is after KCL requested a shutdown, ended the
+	// shard or took the lease away. KCL will not send more records.
+	PhaseShuttingDown Phase = "shutting_down"
+)
+
+// HealthThresholds decide when the manager is considered stuck. A zero
+// threshold disables that check.
+type HealthThresholds struct {
+	// MaxProcessingTime is how long a single ProcessRecords call may
+	// take, including dead letter retries.
+	MaxProcessingTime time.Duration
+	// MaxIdleTime is how long the manager may go without receiving an
+	// action from KCL once initialized. Note that by default KCL does
+	// not send processRecords for empty batches, so a quiet stream can
+	// legitimately go without actions for a while.
+	MaxIdleTime time.Duration
+}
+
+// CheckpointResult is the outcome of the most recent checkpoint.
+type CheckpointResult struct {
+	At     time.Time `json:"at"`
+	SeqNum *string   `json:"seqNum,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Health is a point in time snapshot of what the Manager knows about
+// the shard it is consuming and the components registered with it.
+type Health struct {
+	ShardId         string                  `json:"shardId"`
+	Phase           Phase                   `json:"phase"`
+	Action          string                  `json:"action,omitempty"`
+	CircuitBreakers map[string]BreakerState `json:"circuitBreakers,omitempty"`
+	// SinceLastAction is the time since KCL last sent an action. It is
+	// zero until the first action arrives.
+	SinceLastAction time.Duration `json:"sinceLastAction"`
+	// ProcessingFor is the time spent in the current ProcessRecords
+	// call, or zero when records are not being processed.
+	ProcessingFor  time.Duration     `json:"processingFor"`
+	LastCheckpoint *CheckpointResult `json:"lastCheckpoint,omitempty"`
+	// Stuck lists the thresholds that were exceeded, if any
+	Stuck []string `json:"stuck,omitempty"`
+}
+
+// Live reports whether the manager is making progress, i.e. none of
+// the health thresholds were exceeded.
+func (h Health) Live() bool {
+	return len(h.Stuck) == 0
+}
+
+// Ready reports whether the manager is initialized, live, not shutting
+// down and its last checkpoint (if any) succeeded.
+func (h Health) Ready() bool {
+	if h.Phase == PhaseStarting || h.Phase == PhaseShuttingDown || !h.Live() {
+		return false
+	}
+	return h.LastCheckpoint == nil || h.LastCheckpoint.Error == ""
+}
+
+// WithHealthChecks serves /healthz and /readyz on addr (which may be
+// shared with WithMetrics). /healthz fails once t is exceeded, and
+// /readyz also fails until the shard is initialized, once it is
+// shutting down and while the last checkpoint failed. Both respond with
+// the Health snapshot as json.
+func WithHealthChecks(addr string, t HealthThresholds) ManagerOpts {
+	return func(kclm *Manager) {
+		kclm.thresholds = t
+		kclm.handle(addr, "/healthz", kclm.LivenessHandler())
+		kclm.handle(addr, "/readyz", kclm.ReadinessHandler())
+	}
+}
+
+// Health reports the current state of the manager. It is safe to call
+// from any goroutine while Run is in progress.
+func (kclm *Manager) Health() Health {
+	now := time.Now()
+	kclm.mu.Lock()
+	defer kclm.mu.Unlock()
+	h := Health{
+		ShardId:        kclm.shardId,
+		Phase:          kclm.phase,
+		Action:         kclm.action,
+		LastCheckpoint: kclm.lastCheckpoint,
+	}
+	if h.Phase == "" {
+		h.Phase = PhaseStarting
+	}
+	if len(kclm.breakers) > 0 {
+		h.CircuitBreakers = make(map[string]BreakerState, len(kclm.breakers))
+		for name, cb := range kclm.breakers {
+			h.CircuitBreakers[name] = cb.State()
+		}
+	}
+	if !kclm.lastActionAt.IsZero() {
+		h.SinceLastAction = now.Sub(kclm.lastActionAt)
+	}
+	if !kclm.processingSince.IsZero() {
+		h.ProcessingFor = now.Sub(kclm.processingSince)
+	}
+
+	t := kclm.thresholds
+	if t.MaxProcessingTime > 0 && h.ProcessingFor > t.MaxProcessingTime {
+		h.Stuck = append(h.Stuck, fmt.Sprintf("processing records for %s, over %s", h.ProcessingFor, t.MaxProcessingTime))
+	}
+	// only count idle time while waiting on KCL, a slow action is
+	// covered by MaxProcessingTime
+	if t.MaxIdleTime > 0 && h.Phase == PhaseIdle && h.SinceLastAction > t.MaxIdleTime {
+		h.Stuck = append(h.Stuck, fmt.Sprintf("no action from kcl for %s, over %s", h.SinceLastAction, t.MaxIdleTime))
+	}
+	return h
+}
+
+// LivenessHandler returns the http.Handler behind /healthz, for
+// mounting on a server of your own.
+func (kclm *Manager) LivenessHandler() http.Handler {
+	return kclm.healthHandler(Health.Live)
+}
+
+// ReadinessHandler returns the http.Handler behind /readyz, for
+// mounting on a server of your own.
+func (kclm *Manager) ReadinessHandler() http.Handler {
+	return kclm.healthHandler(Health.Ready)
+}
+
+func (kclm *Manager) healthHandler(ok func(Health) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := kclm.Health()
+		w.Header().Set("Content-Type", "application/json")
+		if !ok(h) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(h)
+	})
+}
+
+// actionStarted records that KCL sent an action.
+func (kclm *Manager) actionStarted(actionType string) {
+	now := time.Now()
+	kclm.mu.Lock()
+	defer kclm.mu.Unlock()
+	kclm.lastActionAt = now
+	kclm.action = actionType
+	if kclm.phase != PhaseShuttingDown {
+		kclm.phase = PhaseProcessing
+	}
+	if actionType == actions.PROCESS_RECORDS {
+		kclm.processingSince = now
+	}
+}
+
+// actionDone records that the manager finished handling an action.
+func (kclm *Manager) actionDone(actionType string, err error) {
+	kclm.mu.Lock()
+	defer kclm.mu.Unlock()
+	kclm.action = ""
+	kclm.processingSince = time.Time{}
+	switch {
+	case kclm.phase == PhaseShuttingDown:
+	case actionType == actions.SHUTDOWN_REQUESTED, actionType == actions.SHARD_ENDED, actionType == actions.LEASE_LOST:
+		kclm.phase = PhaseShuttingDown
+	case kclm.shardId == "" || actionType == actions.INITITALIZE && err != nil:
+		kclm.phase = PhaseStarting
+	default:
+		kclm.phase = PhaseIdle
+	}
+}
+
+// checkpointDone records the result of a checkpoint.
+func (kclm *Manager) checkpointDone(o checkpoint.Observation) {
+	res := &CheckpointResult{At: o.Start.Add(o.Duration), SeqNum: o.SeqNum}
+	if o.Err != nil {
+		res.Error = o.Err.Error()
+	}
+	kclm.mu.Lock()
+	kclm.lastCheckpoint = res
+	kclm.mu.Unlock()
+}
@@ -0,0 +1,116 @@
+package kcl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+func getHealth(t *testing.T, h http.Handler) (int, Health) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var health Health
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &health))
+	return rec.Code, health
+}
+
+func TestHealth(t *testing.T) {
+	t.Run("follows protocol state", func(t *testing.T) {
+		var during Health
+		var manager *Manager
+		rp := &RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				during = manager.Health()
+				return cp.CheckpointBatch()
+			},
+		}
+		manager = NewManager(bytes.NewBufferString(checkpointAck), &bytes.Buffer{}, rp, WithHealthChecks("127.0.0.1:0", HealthThresholds{}))
+
+		code, h := getHealth(t, manager.ReadinessHandler())
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, PhaseStarting, h.Phase)
+		code, _ = getHealth(t, manager.LivenessHandler())
+		assert.Equal(t, http.StatusOK, code)
+
+		assert.NoError(t, manager.processRawAction(rawAction(t, actions.InitAction{Action: actions.INITITALIZE, ShardId: "shard-123"})))
+		code, h = getHealth(t, manager.ReadinessHandler())
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, PhaseIdle, h.Phase)
+		assert.Equal(t, "shard-123", h.ShardId)
+
+		assert.NoError(t, manager.processRawAction(rawAction(t, testProcessAction("1", "2"))))
+		assert.Equal(t, PhaseProcessing, during.Phase)
+		assert.Equal(t, actions.PROCESS_RECORDS, during.Action)
+		assert.NotZero(t, during.ProcessingFor)
+		h = manager.Health()
+		assert.Equal(t, PhaseIdle, h.Phase)
+		assert.Zero(t, h.ProcessingFor)
+		if assert.NotNil(t, h.LastCheckpoint) {
+			assert.Empty(t, h.LastCheckpoint.Error)
+		}
+
+		assert.NoError(t, manager.processRawAction(rawAction(t, actions.RawAction{ActionType: actions.LEASE_LOST})))
+		code, h = getHealth(t, manager.ReadinessHandler())
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, PhaseShuttingDown, h.Phase)
+	})
+
+	t.Run("not ready after failed checkpoint", func(t *testing.T) {
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, new(MockRecordProcessor))
+		manager.shardId = "shard-123"
+		manager.phase = PhaseIdle
+		manager.checkpointDone(checkpoint.Observation{Start: time.Now(), Err: &checkpoint.AckError{Err: "ThrottlingException"}})
+
+		h := manager.Health()
+		assert.True(t, h.Live())
+		assert.False(t, h.Ready())
+		assert.Contains(t, h.LastCheckpoint.Error, "ThrottlingException")
+
+		manager.checkpointDone(checkpoint.Observation{Start: time.Now()})
+		assert.True(t, manager.Health().Ready())
+	})
+
+	t.Run("stuck processing records", func(t *testing.T) {
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, new(MockRecordProcessor), WithHealthChecks("127.0.0.1:0", HealthThresholds{MaxProcessingTime: time.Minute}))
+		manager.shardId = "shard-123"
+		manager.actionStarted(actions.PROCESS_RECORDS)
+		assert.True(t, manager.Health().Live())
+
+		manager.processingSince = time.Now().Add(-2 * time.Minute)
+		code, h := getHealth(t, manager.LivenessHandler())
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Len(t, h.Stuck, 1)
+
+		manager.actionDone(actions.PROCESS_RECORDS, nil)
+		assert.True(t, manager.Health().Live())
+	})
+
+	t.Run("stuck waiting on kcl", func(t *testing.T) {
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, new(MockRecordProcessor), WithHealthChecks("127.0.0.1:0", HealthThresholds{MaxIdleTime: time.Minute}))
+		manager.shardId = "shard-123"
+		manager.actionStarted(actions.PROCESS_RECORDS)
+		manager.actionDone(actions.PROCESS_RECORDS, nil)
+		assert.True(t, manager.Health().Live())
+
+		manager.lastActionAt = time.Now().Add(-2 * time.Minute)
+		h := manager.Health()
+		assert.False(t, h.Live())
+		assert.False(t, h.Ready())
+	})
+
+	t.Run("stays starting after failed initialize", func(t *testing.T) {
+		mockProcessor := new(MockRecordProcessor)
+		mockProcessor.InitializeError = errors.New("no database")
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, mockProcessor)
+		assert.Error(t, manager.processRawAction(rawAction(t, actions.InitAction{Action: actions.INITITALIZE, ShardId: "shard-123"})))
+		assert.Equal(t, PhaseStarting, manager.Health().Phase)
+	})
+}
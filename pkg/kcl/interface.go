@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
 	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/wiretap"
 )
 
 // MultilangInterface is the interface in which you can communicate
@@ -14,34 +16,67 @@ import (
 // to read and write actions/requests, as well as a Checkpointer
 // to allow you to checkpoint your consumption progress.
 type MultilangInterface struct {
-	input        *json.Decoder
+	input        *inbox
 	output       *json.Encoder
 	Checkpointer *checkpoint.Checkpointer
+	cpOpts       []checkpoint.CheckpointerOpts
+	tap          *wiretap.Recorder
+	observe      func(actionType string)
 }
 
 type MultilangInterfaceOpts func(mli *MultilangInterface)
 
 func NewMultilangInterface(i io.Reader, o io.Writer, opts ...MultilangInterfaceOpts) *MultilangInterface {
-	kcli := &MultilangInterface{
-		input:  json.NewDecoder(i),
-		output: json.NewEncoder(o),
-	}
+	kcli := &MultilangInterface{}
 	for _, opt := range opts {
 		opt(kcli)
 	}
-	kcli.Checkpointer = checkpoint.NewCheckpointer(i, o)
+	// the checkpointer shares the tapped streams so its messages are
+	// recorded in order with everything else
+	if kcli.tap != nil {
+		i = kcli.tap.Reader(i, wiretap.In)
+		o = kcli.tap.Writer(o, wiretap.Out)
+	}
+	kcli.input = newInbox(i, kcli.observe)
+	kcli.output = json.NewEncoder(o)
+	cpOpts := append([]checkpoint.CheckpointerOpts{checkpoint.WithAckReader(kcli.input.nextAck)}, kcli.cpOpts...)
+	kcli.Checkpointer = checkpoint.NewCheckpointer(i, o, cpOpts...)
 	return kcli
 }
 
+// WithCheckpointerOpts passes opts on to the interface's Checkpointer.
+func WithCheckpointerOpts(opts ...checkpoint.CheckpointerOpts) MultilangInterfaceOpts {
+	return func(mli *MultilangInterface) {
+		mli.cpOpts = append(mli.cpOpts, opts...)
+	}
+}
+
+// WithWireTap records every message exchanged with the KCL Multilang
+// process, including checkpoints, to rec.
+func WithWireTap(rec *wiretap.Recorder) MultilangInterfaceOpts {
+	return func(mli *MultilangInterface) {
+		mli.tap = rec
+	}
+}
+
+// WithActionObserver calls fn with the type of every action as soon as
+// it arrives, before it is returned by ReadActionRequest, e.g. to react
+// to a shutdown request while a batch is still being processed. fn is
+// called from the goroutine reading the input and must not block.
+func WithActionObserver(fn func(actionType string)) MultilangInterfaceOpts {
+	return func(mli *MultilangInterface) {
+		mli.observe = fn
+	}
+}
+
 // ReadActionRequest reads the next available KCL Multilang action
 // request. KCL Multilang sends its action requests over stdout in the
 // form of json. Please see `internal/actions/` for a list of potential
 // KCL actions requested.
 func (kcli *MultilangInterface) ReadActionRequest() (actions.RawAction, error) {
-	var rawAction actions.RawAction
-	err := kcli.input.Decode(&rawAction)
+	rawAction, err := kcli.input.nextAction()
 	if err != nil {
-		return rawAction, fmt.Errorf("error reading kcl action request: %v", err)
+		return rawAction, fmt.Errorf("error reading kcl action request: %w", err)
 	}
 
 	return rawAction, nil
@@ -60,3 +95,84 @@ func (kcli *MultilangInterface) WriteActionComplete(actionType string) error {
 	}
 	return nil
 }
+
+// maxActionsAhead is how many actions are read ahead of
+// ReadActionRequest. KCL only sends the next action once the last one
+// was answered, but a shutdown request may come while a batch is still
+// being processed.
+const maxActionsAhead = 4
+
+// inbox reads everything the KCL Multilang process sends with a single
+// decoder, so no message is lost to a second decoder reading ahead, and
+// hands checkpoint acks to the Checkpointer and everything else to
+// ReadActionRequest. It reads in the background, starting with the
+// first read, so actions are observed while the processor is busy.
+//
+// Reading stops at the first message that cannot be decoded, since the
+// stream cannot be trusted after it, and the error is returned to every
+// read after the messages that came before it.
+type inbox struct {
+	dec     *json.Decoder
+	observe func(actionType string)
+	start   sync.Once
+	actions chan actions.RawAction
+	acks    chan json.RawMessage
+	// done is closed once reading stopped, err is why
+	done chan struct{}
+	err  error
+}
+
+func newInbox(r io.Reader, observe func(actionType string)) *inbox {
+	return &inbox{
+		dec:     json.NewDecoder(r),
+		observe: observe,
+		actions: make(chan actions.RawAction, maxActionsAhead),
+		acks:    make(chan json.RawMessage, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+func (in *inbox) read() {
+	defer close(in.done)
+	for {
+		var ra actions.RawAction
+		err := in.dec.Decode(&ra)
+		if err != nil {
+			in.err = err
+			return
+		}
+		if ra.ActionType == "checkpoint" {
+			in.acks <- ra.Raw
+			continue
+		}
+		if in.observe != nil {
+			in.observe(ra.ActionType)
+		}
+		in.actions <- ra
+	}
+}
+
+func (in *inbox) nextAction() (actions.RawAction, error) {
+	return receive(in, in.actions)
+}
+
+func (in *inbox) nextAck() (json.RawMessage, error) {
+	return receive(in, in.acks)
+}
+
+func receive[T any](in *inbox, ch chan T) (T, error) {
+	in.start.Do(func() { go in.read() })
+	select {
+	case v := <-ch:
+		return v, nil
+	case <-in.done:
+		// messages read before reading stopped come first
+		select {
+		case v := <-ch:
+			return v, nil
+		default:
+			var zero T
+			return zero, in.err
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package kcl
 
 import (
+	"context"
+	"log/slog"
+
 	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
 	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
 )
@@ -36,3 +39,62 @@ type RecordProcessor interface {
 	// checkpoint its position.
 	ShutdownRequested(cp *checkpoint.Checkpointer) error
 }
+
+// RecordProcessorV2 is RecordProcessor with the Checkpointer taken as a
+// checkpoint.Interface rather than a concrete *checkpoint.Checkpointer,
+// so tests can hand it a fake and the checkpointer can be decorated
+// (e.g. by Middleware replacing Call.Checkpointer). Use it with
+// NewManagerV2.
+type RecordProcessorV2 interface {
+	Initialize(shardId, seqNum string, subSeqNum int) error
+	ProcessRecords(records []actions.Record, lag int, cp checkpoint.Interface) error
+	LeaseLost() error
+	ShardEnded(cp checkpoint.Interface) error
+	ShutdownRequested(cp checkpoint.Interface) error
+}
+
+// AdaptRecordProcessor lets a RecordProcessor be used where a
+// RecordProcessorV2 is expected. Checkpointers that are not a
+// *checkpoint.Checkpointer are wrapped with checkpoint.AsCheckpointer.
+// NewManager does this for you.
+func AdaptRecordProcessor(rp RecordProcessor) RecordProcessorV2 {
+	return &recordProcessorAdapter{rp: rp}
+}
+
+type recordProcessorAdapter struct {
+	rp RecordProcessor
+}
+
+func (a *recordProcessorAdapter) Initialize(shardId, seqNum string, subSeqNum int) error {
+	return a.rp.Initialize(shardId, seqNum, subSeqNum)
+}
+
+func (a *recordProcessorAdapter) ProcessRecords(records []actions.Record, lag int, cp checkpoint.Interface) error {
+	return a.rp.ProcessRecords(records, lag, checkpoint.AsCheckpointer(cp))
+}
+
+func (a *recordProcessorAdapter) LeaseLost() error {
+	return a.rp.LeaseLost()
+}
+
+func (a *recordProcessorAdapter) ShardEnded(cp checkpoint.Interface) error {
+	return a.rp.ShardEnded(checkpoint.AsCheckpointer(cp))
+}
+
+func (a *recordProcessorAdapter) ShutdownRequested(cp checkpoint.Interface) error {
+	return a.rp.ShutdownRequested(checkpoint.AsCheckpointer(cp))
+}
+
+// SetLogger passes l on if the adapted processor is a LoggerSetter.
+func (a *recordProcessorAdapter) SetLogger(l *slog.Logger) {
+	if ls, ok := a.rp.(LoggerSetter); ok {
+		ls.SetLogger(l)
+	}
+}
+
+// SetContext passes ctx on if the adapted processor is a ContextSetter.
+func (a *recordProcessorAdapter) SetContext(ctx context.Context) {
+	if cs, ok := a.rp.(ContextSetter); ok {
+		cs.SetContext(ctx)
+	}
+}
@@ -0,0 +1,104 @@
+package kcl
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+// v2Processor checkpoints every batch through the checkpoint.Interface
+// it is handed.
+type v2Processor struct {
+	cps []checkpoint.Interface
+}
+
+func (p *v2Processor) Initialize(shardId, seqNum string, subSeqNum int) error { return nil }
+func (p *v2Processor) ProcessRecords(records []actions.Record, lag int, cp checkpoint.Interface) error {
+	p.cps = append(p.cps, cp)
+	return cp.CheckpointBatch()
+}
+func (p *v2Processor) LeaseLost() error                                { return nil }
+func (p *v2Processor) ShardEnded(cp checkpoint.Interface) error        { return cp.CheckpointBatch() }
+func (p *v2Processor) ShutdownRequested(cp checkpoint.Interface) error { return nil }
+
+// countingCheckpointer decorates a checkpoint.Interface.
+type countingCheckpointer struct {
+	checkpoint.Interface
+	count int
+}
+
+func (c *countingCheckpointer) CheckpointBatch() error {
+	c.count++
+	return c.Interface.CheckpointBatch()
+}
+
+func TestRecordProcessorV2(t *testing.T) {
+	t.Run("manager hands processor checkpoint interface", func(t *testing.T) {
+		rp := &v2Processor{}
+		manager := NewManagerV2(bytes.NewBufferString(checkpointAck), &bytes.Buffer{}, rp)
+
+		assert.NoError(t, manager.processRawAction(rawAction(t, testProcessAction("1"))))
+		if assert.Len(t, rp.cps, 1) {
+			assert.Same(t, manager.interfacer.Checkpointer, rp.cps[0])
+		}
+	})
+
+	t.Run("middleware decorates checkpointer", func(t *testing.T) {
+		counter := &countingCheckpointer{}
+		decorate := func(next Handler) Handler {
+			return func(call *Call) error {
+				if call.Checkpointer != nil {
+					counter.Interface = call.Checkpointer
+					call.Checkpointer = counter
+				}
+				return next(call)
+			}
+		}
+		rp := &v2Processor{}
+		manager := NewManagerV2(bytes.NewBufferString(checkpointAck), &bytes.Buffer{}, rp, WithMiddleware(decorate))
+
+		assert.NoError(t, manager.processRawAction(rawAction(t, testProcessAction("1"))))
+		assert.Equal(t, 1, counter.count)
+	})
+
+	t.Run("adapts record processor to fake checkpointer", func(t *testing.T) {
+		var seen *checkpoint.Checkpointer
+		boom := errors.New("boom")
+		rp := AdaptRecordProcessor(&RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				seen = cp
+				return cp.CheckpointSubSeqNum("1", 2)
+			},
+		})
+		var gotSeqNum string
+		var gotSubSeqNum int
+		fake := &fakeCheckpointer{subSeqNum: func(seqNum string, subSeqNum int) error {
+			gotSeqNum, gotSubSeqNum = seqNum, subSeqNum
+			return boom
+		}}
+
+		assert.ErrorIs(t, rp.ProcessRecords(testProcessAction("1").Records, 0, fake), boom)
+		assert.NotNil(t, seen)
+		assert.Equal(t, "1", gotSeqNum)
+		assert.Equal(t, 2, gotSubSeqNum)
+
+		// a real checkpointer is passed through as is
+		real := checkpoint.NewCheckpointerFunc(func(*string, *int) error { return nil })
+		assert.NoError(t, rp.ProcessRecords(testProcessAction("1").Records, 0, real))
+		assert.Same(t, real, seen)
+	})
+}
+
+type fakeCheckpointer struct {
+	subSeqNum func(seqNum string, subSeqNum int) error
+}
+
+func (f *fakeCheckpointer) CheckpointBatch() error               { return nil }
+func (f *fakeCheckpointer) CheckpointSeqNum(seqNum string) error { return nil }
+func (f *fakeCheckpointer) CheckpointSubSeqNum(seqNum string, subSeqNum int) error {
+	return f.subSeqNum(seqNum, subSeqNum)
+}
@@ -0,0 +1,110 @@
+package kcltest
+
+import (
+	"sync"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+)
+
+// RecordingCheckpointer is a fake checkpoint.Interface for unit testing
+// a processor's methods directly, without a Manager or Daemon. It
+// records every checkpoint and succeeds unless told otherwise with
+// FailNext. Use AsCheckpointer to hand it to a RecordProcessor that
+// takes a *checkpoint.Checkpointer.
+type RecordingCheckpointer struct {
+	mu          sync.Mutex
+	checkpoints []Checkpoint
+	errs        []error
+}
+
+var _ checkpoint.Interface = (*RecordingCheckpointer)(nil)
+
+// NewRecordingCheckpointer creates a RecordingCheckpointer.
+func NewRecordingCheckpointer() *RecordingCheckpointer {
+	return &RecordingCheckpointer{}
+}
+
+// FailNext makes the next checkpoints return errs, one per checkpoint
+// in order. A nil error lets that checkpoint succeed. To fail like the
+// daemon does, use a *checkpoint.AckError, e.g. with Throttling.
+func (c *RecordingCheckpointer) FailNext(errs ...error) *RecordingCheckpointer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errs = append(c.errs, errs...)
+	return c
+}
+
+func (c *RecordingCheckpointer) record(seqNum *string, subSeqNum *int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cp := Checkpoint{SeqNum: seqNum, SubSeqNum: subSeqNum}
+	var err error
+	if len(c.errs) > 0 {
+		err = c.errs[0]
+		c.errs = c.errs[1:]
+	}
+	if err != nil {
+		cp.Response = err.Error()
+		if ackErr, ok := err.(*checkpoint.AckError); ok {
+			cp.Response = ackErr.Err
+		}
+	}
+	c.checkpoints = append(c.checkpoints, cp)
+	return err
+}
+
+func (c *RecordingCheckpointer) CheckpointBatch() error {
+	return c.record(nil, nil)
+}
+
+func (c *RecordingCheckpointer) CheckpointSeqNum(seqNum string) error {
+	return c.record(&seqNum, nil)
+}
+
+func (c *RecordingCheckpointer) CheckpointSubSeqNum(seqNum string, subSeqNum int) error {
+	return c.record(&seqNum, &subSeqNum)
+}
+
+// AsCheckpointer returns a *checkpoint.Checkpointer recording to c.
+func (c *RecordingCheckpointer) AsCheckpointer() *checkpoint.Checkpointer {
+	return checkpoint.AsCheckpointer(c)
+}
+
+// Checkpoints returns every checkpoint made, in order.
+func (c *RecordingCheckpointer) Checkpoints() []Checkpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Checkpoint(nil), c.checkpoints...)
+}
+
+// LastCheckpoint returns the last checkpoint made, and false if there
+// was none.
+func (c *RecordingCheckpointer) LastCheckpoint() (Checkpoint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.checkpoints) == 0 {
+		return Checkpoint{}, false
+	}
+	return c.checkpoints[len(c.checkpoints)-1], true
+}
+
+// CheckpointedAt reports whether a successful checkpoint was made at
+// r. Any successful CheckpointBatch counts, since the fake cannot know
+// which batch it refers to.
+func (c *RecordingCheckpointer) CheckpointedAt(r actions.Record) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cp := range c.checkpoints {
+		if cp.Response != Success {
+			continue
+		}
+		if cp.SeqNum == nil {
+			return true
+		}
+		if *cp.SeqNum == r.SequenceNumber && (cp.SubSeqNum == nil || *cp.SubSeqNum == r.SubSequenceNumber) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package kcltest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordingCheckpointer(t *testing.T) {
+	t.Run("records checkpoints and scripted failures", func(t *testing.T) {
+		s := NewShard("shardId-000")
+		records := s.StringRecords("a", "b")
+		cp := NewRecordingCheckpointer().FailNext(&checkpoint.AckError{Err: Throttling}, nil)
+
+		var ackErr *checkpoint.AckError
+		assert.ErrorAs(t, cp.CheckpointSeqNum(records[0].SequenceNumber), &ackErr)
+		assert.False(t, cp.CheckpointedAt(records[0]))
+		assert.NoError(t, cp.CheckpointSubSeqNum(records[0].SequenceNumber, 0))
+		assert.True(t, cp.CheckpointedAt(records[0]))
+		assert.False(t, cp.CheckpointedAt(records[1]))
+
+		cps := cp.Checkpoints()
+		if assert.Len(t, cps, 2) {
+			assert.Equal(t, Throttling, cps[0].Response)
+			assert.Nil(t, cps[0].SubSeqNum)
+			assert.Equal(t, Success, cps[1].Response)
+			assert.Equal(t, 0, *cps[1].SubSeqNum)
+		}
+	})
+
+	t.Run("tests record processor directly", func(t *testing.T) {
+		boom := errors.New("boom")
+		rp := &kcl.RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				return cp.CheckpointBatch()
+			},
+		}
+		cp := NewRecordingCheckpointer().FailNext(boom)
+
+		assert.ErrorIs(t, rp.ProcessRecords(NewShard("shardId-000").StringRecords("a"), 0, cp.AsCheckpointer()), boom)
+		assert.NoError(t, rp.ShardEnded(cp.AsCheckpointer()))
+		last, ok := cp.LastCheckpoint()
+		assert.True(t, ok)
+		assert.Nil(t, last.SeqNum)
+		assert.Equal(t, Success, last.Response)
+	})
+}
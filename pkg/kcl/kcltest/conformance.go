@@ -0,0 +1,323 @@
+package kcltest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+)
+
+// conformance configures RunConformance.
+type conformance struct {
+	data       [][]byte
+	daemonOpts []DaemonOpts
+	newDaemon  func(t testing.TB, opts ...DaemonOpts) *Daemon
+}
+
+type ConformanceOpts func(c *conformance)
+
+// WithData sets the payloads of the records in every batch the suite
+// sends, for processors that expect a certain format. By default every
+// batch holds three small json objects.
+func WithData(data ...[]byte) ConformanceOpts {
+	return func(c *conformance) {
+		c.data = data
+	}
+}
+
+// WithDaemonOpts passes opts on to the Daemon running each scenario,
+// e.g. WithManagerOpts to quiet the manager's logs.
+func WithDaemonOpts(opts ...DaemonOpts) ConformanceOpts {
+	return func(c *conformance) {
+		c.daemonOpts = append(c.daemonOpts, opts...)
+	}
+}
+
+// RunConformance checks that the processors made by factory follow the
+// KCL record processor contract. Every scenario runs as a subtest with
+// a new processor from factory:
+//
+//   - normal flow: batches are processed without errors and checkpoints
+//     only ever move forward to records that were delivered.
+//   - shard end: ShardEnded checkpoints with CheckpointBatch, which KCL
+//     requires before the shard's children are processed.
+//   - lease lost: LeaseLost does not checkpoint, the lease belongs to
+//     another worker by then.
+//   - shutdown requested: ShutdownRequested checkpoints successfully
+//     before it returns, it is the processor's last chance to save its
+//     progress before the lease goes to another worker.
+//   - checkpoint throttling: a throttled checkpoint is not returned as an
+//     error, and the shard end checkpoint still succeeds.
+//
+// Returning an error from any RecordProcessor method makes the manager
+// exit, so it fails every scenario.
+func RunConformance(t *testing.T, factory func() kcl.RecordProcessor, opts ...ConformanceOpts) {
+	t.Helper()
+	runConformance(t, func(t testing.TB, opts ...DaemonOpts) *Daemon {
+		return NewDaemon(t, factory(), opts...)
+	}, opts)
+}
+
+// RunConformanceV2 is RunConformance for a kcl.RecordProcessorV2.
+func RunConformanceV2(t *testing.T, factory func() kcl.RecordProcessorV2, opts ...ConformanceOpts) {
+	t.Helper()
+	runConformance(t, func(t testing.TB, opts ...DaemonOpts) *Daemon {
+		return NewDaemonV2(t, factory(), opts...)
+	}, opts)
+}
+
+func runConformance(t *testing.T, newDaemon func(t testing.TB, opts ...DaemonOpts) *Daemon, opts []ConformanceOpts) {
+	c := &conformance{
+		data:      [][]byte{[]byte(`{"id":1}`), []byte(`{"id":2}`), []byte(`{"id":3}`)},
+		newDaemon: newDaemon,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			s.run(c.start(t))
+		})
+	}
+}
+
+// scenarios are the lifecycles RunConformance drives a processor
+// through. They report broken rules with Errorf rather than Fatalf and
+// stop at the first one.
+var scenarios = []struct {
+	name string
+	run  func(r *conformanceRun)
+}{
+	{"normal flow", func(r *conformanceRun) {
+		r.initialize()
+		for range 3 {
+			r.processBatch()
+		}
+		r.close()
+	}},
+	{"shard end", func(r *conformanceRun) {
+		r.initialize()
+		r.processBatch()
+		r.shardEnded()
+	}},
+	{"lease lost", func(r *conformanceRun) {
+		r.initialize()
+		r.processBatch()
+		r.processBatch()
+		r.send(actions.LEASE_LOST, func(d *Daemon) { d.LeaseLost() })
+		if cps := r.since(); len(cps) > 0 {
+			r.fail("LeaseLost must not checkpoint, the lease is held by another worker once it is lost, but it checkpointed %s", describe(cps[0]))
+		}
+		r.close()
+	}},
+	{"shutdown requested", func(r *conformanceRun) {
+		r.initialize()
+		r.processBatch()
+		r.shutdownRequested()
+		r.close()
+	}},
+	{"checkpoint throttling", func(r *conformanceRun) {
+		r.d.RespondWith(Throttling)
+		r.initialize()
+		r.processBatch()
+		r.processBatch()
+		r.shardEnded()
+	}},
+}
+
+// conformanceRun is a single scenario in progress. It keeps track of
+// the records delivered to check the processor's checkpoints against.
+type conformanceRun struct {
+	t     testing.TB
+	d     *Daemon
+	c     *conformance
+	shard *Shard
+
+	// positions maps each delivered record to its position in the
+	// stream, and lastPositions each sequence number to the position
+	// of its last sub sequence
+	positions     map[string]int
+	lastPositions map[string]int
+	delivered     int
+	batchEnd      int
+	// checkpointed is the position of the last successful checkpoint
+	checkpointed int
+	// checked counts the checkpoints checked so far, lastChecked those
+	// made during the last action
+	checked     int
+	lastChecked int
+	failed      bool
+}
+
+func (c *conformance) start(t testing.TB) *conformanceRun {
+	return &conformanceRun{
+		t:             t,
+		d:             c.newDaemon(t, c.daemonOpts...),
+		c:             c,
+		shard:         NewShard("shardId-000000000000"),
+		positions:     map[string]int{},
+		lastPositions: map[string]int{},
+		batchEnd:      -1,
+		checkpointed:  -1,
+	}
+}
+
+func (r *conformanceRun) fail(format string, args ...any) {
+	r.t.Helper()
+	r.t.Errorf("kcltest: contract broken: "+format, args...)
+	r.failed = true
+}
+
+// send sends action with fn unless the scenario already failed, and
+// checks the processor responded and checkpointed sensibly.
+func (r *conformanceRun) send(action string, fn func(d *Daemon)) bool {
+	r.t.Helper()
+	if r.failed {
+		return false
+	}
+	fn(r.d)
+	if r.d.Exited() {
+		if cp, ok := r.d.LastCheckpoint(); ok && cp.Response != Success {
+			r.fail("%s returned an error after its checkpoint failed with %s, failed checkpoints must be retried or left to a later call: %v", action, cp.Response, r.d.Err())
+			return false
+		}
+		r.fail("%s returned an error, which makes the manager exit and KCL restart the processor: %v", action, r.d.Err())
+		return false
+	}
+	r.checkCheckpoints(action)
+	return !r.failed
+}
+
+func (r *conformanceRun) initialize() {
+	r.t.Helper()
+	r.send(actions.INITITALIZE, func(d *Daemon) { d.Initialize(r.shard.ID) })
+}
+
+func (r *conformanceRun) processBatch() {
+	r.t.Helper()
+	records := r.shard.Records(r.c.data...)
+	for _, rec := range records {
+		r.positions[position(rec.SequenceNumber, rec.SubSequenceNumber)] = r.delivered
+		r.lastPositions[rec.SequenceNumber] = r.delivered
+		r.delivered++
+	}
+	if len(records) > 0 {
+		r.batchEnd = r.delivered - 1
+	}
+	r.send(actions.PROCESS_RECORDS, func(d *Daemon) { d.ProcessBatch(r.shard.Batch(records...)) })
+}
+
+func (r *conformanceRun) shardEnded() {
+	r.t.Helper()
+	if !r.send(actions.SHARD_ENDED, func(d *Daemon) { d.ShardEnded() }) {
+		return
+	}
+	cps := r.since()
+	if len(cps) == 0 {
+		r.fail("ShardEnded must checkpoint with CheckpointBatch, KCL does not process the shard's children until it does, but it did not checkpoint")
+		return
+	}
+	last := cps[len(cps)-1]
+	switch {
+	case last.SeqNum != nil:
+		r.fail("ShardEnded must checkpoint with CheckpointBatch to mark the end of the shard, but it checkpointed %s", describe(last))
+	case last.Response != Success:
+		r.fail("ShardEnded must retry its checkpoint until it succeeds, but the last one failed with %s", last.Response)
+	}
+}
+
+func (r *conformanceRun) shutdownRequested() {
+	r.t.Helper()
+	if !r.send(actions.SHUTDOWN_REQUESTED, func(d *Daemon) { d.ShutdownRequested() }) {
+		return
+	}
+	cps := r.since()
+	if len(cps) == 0 {
+		r.fail("ShutdownRequested must checkpoint, the records processed since the last checkpoint are processed again by the next worker otherwise, but it did not checkpoint")
+		return
+	}
+	if last := cps[len(cps)-1]; last.Response != Success {
+		r.fail("ShutdownRequested must retry its checkpoint until it succeeds, but the last one failed with %s", last.Response)
+	}
+}
+
+// since returns the checkpoints made during the last action.
+func (r *conformanceRun) since() []Checkpoint {
+	cps := r.d.Checkpoints()
+	return cps[len(cps)-r.lastChecked:]
+}
+
+// close closes the processor's input like the daemon does once a
+// shard is done.
+func (r *conformanceRun) close() {
+	r.t.Helper()
+	if r.failed {
+		return
+	}
+	if err := r.d.Close(); err != nil {
+		r.fail("the manager exited with an error when its input was closed: %v", err)
+	}
+}
+
+// checkCheckpoints checks the checkpoints made during action only move
+// forward to records that were delivered.
+func (r *conformanceRun) checkCheckpoints(action string) {
+	r.t.Helper()
+	cps := r.d.Checkpoints()
+	r.lastChecked = len(cps) - r.checked
+	for _, cp := range cps[r.checked:] {
+		r.checked++
+		if cp.SeqNum == nil {
+			if action == actions.SHARD_ENDED {
+				continue
+			}
+			if r.batchEnd < 0 {
+				r.fail("%s checkpointed with CheckpointBatch before any records were delivered", action)
+				return
+			}
+		}
+		pos, ok := r.position(cp)
+		if !ok {
+			r.fail("%s checkpointed %s, which was never delivered to it", action, describe(cp))
+			return
+		}
+		if pos < r.checkpointed {
+			r.fail("%s checkpointed %s, behind an earlier checkpoint, checkpoints must only move forward", action, describe(cp))
+			return
+		}
+		if cp.Response == Success {
+			r.checkpointed = pos
+		}
+	}
+}
+
+// position returns the position in the stream cp refers to.
+func (r *conformanceRun) position(cp Checkpoint) (int, bool) {
+	switch {
+	case cp.SeqNum == nil:
+		return r.batchEnd, true
+	case cp.SubSeqNum == nil:
+		pos, ok := r.lastPositions[*cp.SeqNum]
+		return pos, ok
+	default:
+		pos, ok := r.positions[position(*cp.SeqNum, *cp.SubSeqNum)]
+		return pos, ok
+	}
+}
+
+func position(seqNum string, subSeqNum int) string {
+	return fmt.Sprintf("%s/%d", seqNum, subSeqNum)
+}
+
+// describe formats a checkpoint for an error message.
+func describe(cp Checkpoint) string {
+	switch {
+	case cp.SeqNum == nil:
+		return "the batch"
+	case cp.SubSeqNum == nil:
+		return fmt.Sprintf("sequence number %s", *cp.SeqNum)
+	default:
+		return fmt.Sprintf("sequence number %s/%d", *cp.SeqNum, *cp.SubSeqNum)
+	}
+}
@@ -0,0 +1,116 @@
+package kcltest
+
+import (
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+// runScenario runs a single conformance scenario against rp, recording
+// broken rules instead of failing the test.
+func runScenario(t *testing.T, name string, rp kcl.RecordProcessor) []string {
+	tb := &errorsTB{TB: t}
+	c := &conformance{
+		data:       [][]byte{[]byte("a"), []byte("b")},
+		daemonOpts: []DaemonOpts{quiet},
+		newDaemon: func(t testing.TB, opts ...DaemonOpts) *Daemon {
+			return NewDaemon(t, rp, opts...)
+		},
+	}
+	for _, s := range scenarios {
+		if s.name == name {
+			s.run(c.start(tb))
+			return tb.errs
+		}
+	}
+	t.Fatalf("no scenario %q", name)
+	return nil
+}
+
+func TestRunConformance(t *testing.T) {
+	t.Run("passes processor following contract", func(t *testing.T) {
+		RunConformance(t, func() kcl.RecordProcessor {
+			return retryingProcessor(checkpointLast)
+		}, WithDaemonOpts(quiet))
+	})
+
+	t.Run("passes v2 processor following contract", func(t *testing.T) {
+		RunConformanceV2(t, func() kcl.RecordProcessorV2 {
+			return kcl.AdaptRecordProcessor(retryingProcessor(checkpointBatch))
+		}, WithDaemonOpts(quiet))
+	})
+
+	t.Run("fails checkpoint in lease lost", func(t *testing.T) {
+		var saved *checkpoint.Checkpointer
+		rp := &kcl.RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				saved = cp
+				return nil
+			},
+			LeaseLostFunc: func() error {
+				return saved.CheckpointBatch()
+			},
+		}
+		errs := runScenario(t, "lease lost", rp)
+		if assert.Len(t, errs, 1) {
+			assert.Contains(t, errs[0], "LeaseLost must not checkpoint")
+		}
+	})
+
+	t.Run("fails shard end without checkpoint", func(t *testing.T) {
+		rp := retryingProcessor(checkpointLast)
+		rp.ShardEndedFunc = func(cp *checkpoint.Checkpointer) error { return nil }
+		errs := runScenario(t, "shard end", rp)
+		if assert.Len(t, errs, 1) {
+			assert.Contains(t, errs[0], "ShardEnded must checkpoint with CheckpointBatch")
+		}
+	})
+
+	t.Run("fails shutdown requested without checkpoint", func(t *testing.T) {
+		rp := retryingProcessor(checkpointLast)
+		rp.ShutdownRequestedFunc = func(cp *checkpoint.Checkpointer) error { return nil }
+		errs := runScenario(t, "shutdown requested", rp)
+		if assert.Len(t, errs, 1) {
+			assert.Contains(t, errs[0], "ShutdownRequested must checkpoint")
+		}
+	})
+
+	t.Run("fails checkpoint of unknown record", func(t *testing.T) {
+		rp := retryingProcessor(func(records []actions.Record, cp *checkpoint.Checkpointer) error {
+			return cp.CheckpointSeqNum("1")
+		})
+		errs := runScenario(t, "normal flow", rp)
+		if assert.Len(t, errs, 1) {
+			assert.Contains(t, errs[0], "processRecords checkpointed sequence number 1, which was never delivered")
+		}
+	})
+
+	t.Run("fails checkpoint going backwards", func(t *testing.T) {
+		var first *actions.Record
+		rp := retryingProcessor(func(records []actions.Record, cp *checkpoint.Checkpointer) error {
+			if first == nil {
+				first = &records[0]
+				return cp.CheckpointBatch()
+			}
+			return cp.CheckpointSeqNum(first.SequenceNumber)
+		})
+		errs := runScenario(t, "normal flow", rp)
+		if assert.Len(t, errs, 1) {
+			assert.Contains(t, errs[0], "behind an earlier checkpoint")
+		}
+	})
+
+	t.Run("fails throttled checkpoint returned as error", func(t *testing.T) {
+		errs := runScenario(t, "checkpoint throttling", &kcl.RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				return cp.CheckpointBatch()
+			},
+		})
+		if assert.Len(t, errs, 1) {
+			assert.Contains(t, errs[0], "processRecords returned an error after its checkpoint failed with ThrottlingException")
+		}
+	})
+}
@@ -0,0 +1,381 @@
+// Package kcltest provides a fake KCL MultiLangDaemon for testing
+// RecordProcessors end to end, without a JVM or a Kinesis stream.
+//
+// A Daemon runs a kcl.Manager wrapping the processor under test and
+// talks to it over pipes exactly like the real daemon does over stdin
+// and stdout: it sends one action at a time, answers checkpoints with
+// scripted responses and waits for the status response before sending
+// the next action. SendAll sends several actions at once, for testing
+// shutdown requests arriving while a batch is being processed.
+package kcltest
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+)
+
+// Errors the daemon can answer a checkpoint with, see RespondWith.
+const (
+	Success      = ""
+	Throttling   = "ThrottlingException"
+	Shutdown     = "ShutdownException"
+	InvalidState = "InvalidStateException"
+)
+
+// Checkpoint is a checkpoint the processor sent to the daemon.
+type Checkpoint struct {
+	// SeqNum is nil for a CheckpointBatch
+	SeqNum *string
+	// SubSeqNum is nil unless CheckpointSubSeqNum was used
+	SubSeqNum *int
+	// Response is the error the daemon answered with, Success if none
+	Response string
+}
+
+// message is anything the processor sends to the daemon
+type message struct {
+	Action      string  `json:"action"`
+	ResponseFor string  `json:"responseFor"`
+	SeqNum      *string `json:"sequenceNumber"`
+	SubSeqNum   *int    `json:"subSequenceNumber"`
+	// raw is the message as it was sent
+	raw json.RawMessage
+}
+
+type checkpointAck struct {
+	Action    string  `json:"action"`
+	SeqNum    *string `json:"sequenceNumber"`
+	SubSeqNum *int    `json:"subSequenceNumber"`
+	Error     string  `json:"error"`
+}
+
+// Daemon is a fake KCL MultiLangDaemon driving a kcl.Manager. Its
+// action methods block until the processor responded (or the manager
+// exited) and return the Daemon so calls can be chained:
+//
+//	d := kcltest.NewDaemon(t, rp)
+//	d.Initialize("shardId-000").ProcessRecords(records...).ShardEnded()
+//
+// Protocol violations and timeouts fail the test. An error returned by
+// the processor makes the manager exit, which is reported by Err.
+type Daemon struct {
+	t       testing.TB
+	manager *kcl.Manager
+	timeout time.Duration
+	mgrOpts []kcl.ManagerOpts
+
+	stdin *io.PipeWriter
+	msgs  chan message
+	done  chan error
+
+	exited      bool
+	err         error
+	responses   []string
+	responder   func(cp Checkpoint) string
+	statuses    []string
+	checkpoints []Checkpoint
+	update      bool
+}
+
+type DaemonOpts func(d *Daemon)
+
+// WithTimeout sets how long the daemon waits for the processor to
+// respond to an action. It defaults to 5 seconds.
+func WithTimeout(timeout time.Duration) DaemonOpts {
+	return func(d *Daemon) {
+		d.timeout = timeout
+	}
+}
+
+// WithManagerOpts passes opts on to the kcl.Manager running the
+// processor.
+func WithManagerOpts(opts ...kcl.ManagerOpts) DaemonOpts {
+	return func(d *Daemon) {
+		d.mgrOpts = append(d.mgrOpts, opts...)
+	}
+}
+
+// WithTranscriptUpdate makes Replay rewrite the transcript with what the
+// processor sent instead of comparing them, e.g. when the test package's
+// own -update flag is set.
+func WithTranscriptUpdate(update bool) DaemonOpts {
+	return func(d *Daemon) {
+		d.update = update
+	}
+}
+
+// WithCheckpointResponder answers every checkpoint not already
+// answered by RespondWith with the error fn returns, Success for none.
+func WithCheckpointResponder(fn func(cp Checkpoint) string) DaemonOpts {
+	return func(d *Daemon) {
+		d.responder = fn
+	}
+}
+
+// NewDaemon starts a kcl.Manager running rp with Start and connects it
+// to a new Daemon. The manager is stopped when the test finishes.
+func NewDaemon(t testing.TB, rp kcl.RecordProcessor, opts ...DaemonOpts) *Daemon {
+	t.Helper()
+	return newDaemon(t, func(i io.Reader, o io.Writer, mgrOpts []kcl.ManagerOpts) *kcl.Manager {
+		return kcl.NewManager(i, o, rp, mgrOpts...)
+	}, opts)
+}
+
+// NewDaemonV2 is NewDaemon for a kcl.RecordProcessorV2.
+func NewDaemonV2(t testing.TB, rp kcl.RecordProcessorV2, opts ...DaemonOpts) *Daemon {
+	t.Helper()
+	return newDaemon(t, func(i io.Reader, o io.Writer, mgrOpts []kcl.ManagerOpts) *kcl.Manager {
+		return kcl.NewManagerV2(i, o, rp, mgrOpts...)
+	}, opts)
+}
+
+func newDaemon(t testing.TB, newManager func(i io.Reader, o io.Writer, opts []kcl.ManagerOpts) *kcl.Manager, opts []DaemonOpts) *Daemon {
+	d := &Daemon{
+		t:       t,
+		timeout: 5 * time.Second,
+		msgs:    make(chan message),
+		done:    make(chan error, 1),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	d.stdin = stdinW
+	d.manager = newManager(stdinR, stdoutW, d.mgrOpts)
+	go func() {
+		err := d.manager.Start()
+		// unblock the daemon whichever side it is waiting on
+		stdinR.Close()
+		stdoutW.Close()
+		d.done <- err
+	}()
+	go func() {
+		defer close(d.msgs)
+		dec := json.NewDecoder(stdoutR)
+		for {
+			var raw json.RawMessage
+			err := dec.Decode(&raw)
+			if err != nil {
+				return
+			}
+			var msg message
+			json.Unmarshal(raw, &msg)
+			msg.raw = raw
+			d.msgs <- msg
+		}
+	}()
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// Manager returns the manager running the processor under test.
+func (d *Daemon) Manager() *kcl.Manager {
+	return d.manager
+}
+
+// RespondWith queues the responses to the next checkpoints, one per
+// checkpoint in order. Once the queue is empty checkpoints succeed (or
+// are answered by WithCheckpointResponder).
+func (d *Daemon) RespondWith(responses ...string) *Daemon {
+	d.responses = append(d.responses, responses...)
+	return d
+}
+
+// Initialize sends the initialize action for shardId, starting from
+// the beginning of the shard.
+func (d *Daemon) Initialize(shardId string) *Daemon {
+	d.t.Helper()
+	return d.Send(actions.InitAction{Action: actions.INITITALIZE, ShardId: shardId})
+}
+
+// ProcessRecords sends records as a processRecords action.
+func (d *Daemon) ProcessRecords(records ...actions.Record) *Daemon {
+	d.t.Helper()
+	return d.ProcessBatch(actions.ProcessAction{Records: records})
+}
+
+// ProcessBatch sends a processRecords action, e.g. to set
+// MillisBehindLatest.
+func (d *Daemon) ProcessBatch(a actions.ProcessAction) *Daemon {
+	d.t.Helper()
+	a.Action = actions.PROCESS_RECORDS
+	if a.Records == nil {
+		a.Records = []actions.Record{}
+	}
+	return d.Send(a)
+}
+
+// LeaseLost sends the leaseLost action.
+func (d *Daemon) LeaseLost() *Daemon {
+	d.t.Helper()
+	return d.Send(actions.LeaseLostAction{Action: actions.LEASE_LOST})
+}
+
+// ShardEnded sends the shardEnded action.
+func (d *Daemon) ShardEnded() *Daemon {
+	d.t.Helper()
+	return d.Send(actions.ShardEndedAction{Action: actions.SHARD_ENDED})
+}
+
+// ShutdownRequested sends the shutdownRequested action.
+func (d *Daemon) ShutdownRequested() *Daemon {
+	d.t.Helper()
+	return d.Send(actions.ShutdownRequestedAction{Action: actions.SHUTDOWN_REQUESTED})
+}
+
+// Send sends any action, which must marshal to a json object with an
+// "action" field, and waits for the processor to respond to it.
+func (d *Daemon) Send(action any) *Daemon {
+	d.t.Helper()
+	return d.SendAll(action)
+}
+
+// SendAll sends every action without waiting for the responses in
+// between, like the daemon requesting a shutdown while a batch is still
+// being processed, and then waits for the processor to respond to each
+// of them in order.
+func (d *Daemon) SendAll(acts ...any) *Daemon {
+	d.t.Helper()
+	if d.exited {
+		d.t.Fatalf("kcltest: cannot send action, manager already exited: %v", d.err)
+		return d
+	}
+	var lines []byte
+	var pending []string
+	for _, action := range acts {
+		b, err := json.Marshal(action)
+		if err != nil {
+			d.t.Fatalf("kcltest: error encoding action: %v", err)
+			return d
+		}
+		var a struct {
+			Action string `json:"action"`
+		}
+		json.Unmarshal(b, &a)
+		pending = append(pending, a.Action)
+		lines = append(append(lines, b...), '\n')
+	}
+
+	// the write blocks until the manager reads it, so it shares the
+	// timeout with waiting for the responses
+	timer := time.NewTimer(d.timeout)
+	defer timer.Stop()
+	written := make(chan error, 1)
+	go func() {
+		_, err := d.stdin.Write(lines)
+		written <- err
+	}()
+	for len(pending) > 0 {
+		select {
+		case <-timer.C:
+			d.t.Fatalf("kcltest: timed out after %s waiting for response to %s", d.timeout, pending[0])
+			return d
+		case <-written:
+			// a failed write means the manager exited, which shows up
+			// as the end of its output below
+			written = nil
+		case msg, ok := <-d.msgs:
+			if !ok {
+				d.exit()
+				return d
+			}
+			switch msg.Action {
+			case "checkpoint":
+				d.checkpoint(msg)
+			case "status":
+				if msg.ResponseFor != pending[0] {
+					d.t.Fatalf("kcltest: got status response for %q while waiting on %q", msg.ResponseFor, pending[0])
+					return d
+				}
+				d.statuses = append(d.statuses, msg.ResponseFor)
+				pending = pending[1:]
+			default:
+				d.t.Fatalf("kcltest: unexpected message from processor: %+v", msg)
+				return d
+			}
+		}
+	}
+	return d
+}
+
+func (d *Daemon) checkpoint(msg message) {
+	cp := Checkpoint{SeqNum: msg.SeqNum, SubSeqNum: msg.SubSeqNum}
+	switch {
+	case len(d.responses) > 0:
+		cp.Response = d.responses[0]
+		d.responses = d.responses[1:]
+	case d.responder != nil:
+		cp.Response = d.responder(cp)
+	}
+	d.checkpoints = append(d.checkpoints, cp)
+	ack, _ := json.Marshal(checkpointAck{
+		Action:    "checkpoint",
+		SeqNum:    msg.SeqNum,
+		SubSeqNum: msg.SubSeqNum,
+		Error:     cp.Response,
+	})
+	// written from a goroutine since the processor may never read the
+	// ack, e.g. when the manager exits right after checkpointing
+	go d.stdin.Write(append(ack, '\n'))
+}
+
+// exit waits for the manager to return.
+func (d *Daemon) exit() {
+	if d.exited {
+		return
+	}
+	select {
+	case d.err = <-d.done:
+	case <-time.After(d.timeout):
+		d.t.Fatalf("kcltest: timed out after %s waiting for manager to exit", d.timeout)
+	}
+	d.exited = true
+}
+
+// Close closes the processor's input like the daemon does when it shuts
+// down, and returns the error the manager exited with.
+func (d *Daemon) Close() error {
+	d.stdin.Close()
+	// drain anything the manager still writes so it can exit
+	for range d.msgs {
+	}
+	d.exit()
+	return d.err
+}
+
+// Err returns the error the manager exited with once it has exited.
+func (d *Daemon) Err() error {
+	return d.err
+}
+
+// Exited reports whether the manager has exited.
+func (d *Daemon) Exited() bool {
+	return d.exited
+}
+
+// Statuses returns the actions the processor sent status responses for,
+// in order.
+func (d *Daemon) Statuses() []string {
+	return append([]string(nil), d.statuses...)
+}
+
+// Checkpoints returns every checkpoint the processor sent, in order.
+func (d *Daemon) Checkpoints() []Checkpoint {
+	return append([]Checkpoint(nil), d.checkpoints...)
+}
+
+// LastCheckpoint returns the last checkpoint the processor sent, and
+// false if it has not sent any.
+func (d *Daemon) LastCheckpoint() (Checkpoint, bool) {
+	if len(d.checkpoints) == 0 {
+		return Checkpoint{}, false
+	}
+	return d.checkpoints[len(d.checkpoints)-1], true
+}
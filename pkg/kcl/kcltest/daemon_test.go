@@ -0,0 +1,110 @@
+package kcltest
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+var quiet = WithManagerOpts(kcl.WithManagerLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+func TestDaemon(t *testing.T) {
+	t.Run("drives processor through its lifecycle", func(t *testing.T) {
+		var shardId string
+		var processed []string
+		rp := &kcl.RecordProcessorFuncs{
+			InitializeFunc: func(id, seqNum string, subSeqNum int) error {
+				shardId = id
+				return nil
+			},
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				for _, r := range records {
+					processed = append(processed, r.SequenceNumber)
+				}
+				return cp.CheckpointBatch()
+			},
+		}
+		d := NewDaemon(t, rp, quiet)
+		d.Initialize("shardId-000").
+			ProcessRecords(actions.Record{SequenceNumber: "1"}, actions.Record{SequenceNumber: "2"}).
+			ProcessRecords(actions.Record{SequenceNumber: "3"}).
+			ShutdownRequested()
+
+		assert.Equal(t, "shardId-000", shardId)
+		assert.Equal(t, []string{"1", "2", "3"}, processed)
+		assert.Equal(t, []string{actions.INITITALIZE, actions.PROCESS_RECORDS, actions.PROCESS_RECORDS, actions.SHUTDOWN_REQUESTED}, d.Statuses())
+		cps := d.Checkpoints()
+		if assert.Len(t, cps, 3) {
+			assert.Nil(t, cps[0].SeqNum)
+			// the default ShutdownRequested checkpoints the last record
+			assert.Equal(t, "3", *cps[2].SeqNum)
+			assert.Equal(t, 0, *cps[2].SubSeqNum)
+		}
+		assert.NoError(t, d.Close())
+		assert.Equal(t, kcl.PhaseShuttingDown, d.Manager().Health().Phase)
+	})
+
+	t.Run("scripts checkpoint responses", func(t *testing.T) {
+		var errs []error
+		rp := &kcl.RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				for range 3 {
+					errs = append(errs, cp.CheckpointSeqNum(records[0].SequenceNumber))
+				}
+				return nil
+			},
+		}
+		d := NewDaemon(t, rp, quiet)
+		d.RespondWith(Throttling, Shutdown).ProcessRecords(actions.Record{SequenceNumber: "1"})
+
+		if assert.Len(t, errs, 3) {
+			var ackErr *checkpoint.AckError
+			if assert.ErrorAs(t, errs[0], &ackErr) {
+				assert.Equal(t, Throttling, ackErr.Err)
+			}
+			assert.ErrorAs(t, errs[1], &ackErr)
+			assert.Equal(t, Shutdown, ackErr.Err)
+			assert.NoError(t, errs[2])
+		}
+		cp, ok := d.LastCheckpoint()
+		assert.True(t, ok)
+		assert.Equal(t, Success, cp.Response)
+	})
+
+	t.Run("uses checkpoint responder", func(t *testing.T) {
+		rp := &kcl.RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				return cp.CheckpointBatch()
+			},
+		}
+		d := NewDaemon(t, rp, quiet, WithCheckpointResponder(func(cp Checkpoint) string { return InvalidState }))
+		d.ProcessRecords(actions.Record{SequenceNumber: "1"})
+
+		assert.True(t, d.Exited())
+		var ackErr *checkpoint.AckError
+		assert.ErrorAs(t, d.Err(), &ackErr)
+		assert.Empty(t, d.Statuses())
+	})
+
+	t.Run("reports processor errors", func(t *testing.T) {
+		boom := errors.New("boom")
+		rp := &kcl.RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				return boom
+			},
+		}
+		d := NewDaemon(t, rp, quiet)
+		d.Initialize("shardId-000").ProcessRecords(actions.Record{SequenceNumber: "1"})
+
+		assert.True(t, d.Exited())
+		assert.ErrorIs(t, d.Err(), boom)
+		assert.Equal(t, []string{actions.INITITALIZE}, d.Statuses())
+		assert.ErrorIs(t, d.Close(), boom)
+	})
+}
@@ -0,0 +1,204 @@
+// Package faultio injects faults into the streams between a kcl.Manager
+// and the KCL MultiLangDaemon: truncated input, failing writes, reads
+// and writes split at random points, and malformed checkpoint acks.
+//
+// The wrappers are plain io.Readers and io.Writers, so they plug into
+// kcl.NewManager and kcl.NewMultilangInterface directly. Randomness is
+// seeded, so a failing run can be reproduced with the same seed.
+//
+// faultio does not import kcl, so kcl's own tests can use it.
+package faultio
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+)
+
+// ErrInjected is the error injected by default.
+var ErrInjected = errors.New("faultio: injected fault")
+
+type faults struct {
+	rng *rand.Rand
+	// failAt is the number of bytes after which err is returned, -1 for
+	// never
+	failAt   int64
+	err      error
+	prob     float64
+	probErr  error
+	maxChunk int
+}
+
+type Opts func(f *faults)
+
+// WithSeed seeds the randomness of WithChunks and FailRandomly. It
+// defaults to 1.
+func WithSeed(seed int64) Opts {
+	return func(f *faults) {
+		f.rng = rand.New(rand.NewSource(seed))
+	}
+}
+
+// FailAfter lets n bytes through and then fails every read or write with
+// err, ErrInjected if nil. A write crossing the limit writes what fits
+// and returns err.
+func FailAfter(n int64, err error) Opts {
+	return func(f *faults) {
+		f.failAt = n
+		f.err = err
+	}
+}
+
+// Truncate ends the stream with io.EOF after n bytes, like a daemon
+// that went away mid message.
+func Truncate(n int64) Opts {
+	return FailAfter(n, io.EOF)
+}
+
+// FailRandomly fails each read or write with probability p with err,
+// ErrInjected if nil. Nothing is read or written by a failed call.
+func FailRandomly(p float64, err error) Opts {
+	return func(f *faults) {
+		f.prob = p
+		f.probErr = err
+	}
+}
+
+// WithChunks splits reads and writes into random chunks of 1 to max
+// bytes.
+func WithChunks(max int) Opts {
+	return func(f *faults) {
+		f.maxChunk = max
+	}
+}
+
+func newFaults(opts []Opts) *faults {
+	f := &faults{failAt: -1}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if f.rng == nil {
+		f.rng = rand.New(rand.NewSource(1))
+	}
+	if f.err == nil {
+		f.err = ErrInjected
+	}
+	if f.probErr == nil {
+		f.probErr = ErrInjected
+	}
+	return f
+}
+
+// limit returns how many of n bytes may go through after done bytes
+// went through already, and the error to return once they have.
+func (f *faults) limit(done int64, n int) (int, error) {
+	if f.prob > 0 && f.rng.Float64() < f.prob {
+		return 0, f.probErr
+	}
+	if f.maxChunk > 0 && n > 1 {
+		n = min(n, 1+f.rng.Intn(f.maxChunk))
+	}
+	if f.failAt >= 0 {
+		left := f.failAt - done
+		if left <= 0 {
+			return 0, f.err
+		}
+		if int64(n) > left {
+			return int(left), f.err
+		}
+	}
+	return n, nil
+}
+
+// Reader injects faults into an io.Reader. It is safe for concurrent
+// use.
+type Reader struct {
+	mu sync.Mutex
+	r  io.Reader
+	f  *faults
+	n  int64
+}
+
+// NewReader wraps r to inject the faults given by opts.
+func NewReader(r io.Reader, opts ...Opts) *Reader {
+	return &Reader{r: r, f: newFaults(opts)}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(p) == 0 {
+		return 0, nil
+	}
+	limit, fault := r.f.limit(r.n, len(p))
+	if limit == 0 {
+		return 0, fault
+	}
+	n, err := r.r.Read(p[:limit])
+	r.n += int64(n)
+	if err == nil && n == limit && fault != nil {
+		err = fault
+	}
+	return n, err
+}
+
+// N returns the number of bytes read so far.
+func (r *Reader) N() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.n
+}
+
+// Writer injects faults into an io.Writer. Chunked writes are passed on
+// as several writes.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+	f  *faults
+	n  int64
+}
+
+// NewWriter wraps w to inject the faults given by opts.
+func NewWriter(w io.Writer, opts ...Opts) *Writer {
+	return &Writer{w: w, f: newFaults(opts)}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	written := 0
+	for written < len(p) {
+		limit, fault := w.f.limit(w.n, len(p)-written)
+		n, err := w.w.Write(p[written : written+limit])
+		written += n
+		w.n += int64(n)
+		if err != nil {
+			return written, err
+		}
+		if fault != nil {
+			return written, fault
+		}
+	}
+	return written, nil
+}
+
+// N returns the number of bytes written so far.
+func (w *Writer) N() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.n
+}
+
+// Lines returns a reader of lines, each terminated by a newline. Reads
+// are not split at lines, so a read can return several messages, like
+// a daemon that sends the next message before the last was read.
+func Lines(lines ...string) io.Reader {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(strings.TrimSuffix(line, "\n"))
+		b.WriteByte('\n')
+	}
+	return strings.NewReader(b.String())
+}
@@ -0,0 +1,90 @@
+package faultio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReader(t *testing.T) {
+	t.Run("truncates input", func(t *testing.T) {
+		r := NewReader(strings.NewReader("hello world"), Truncate(5))
+		b, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(b))
+		assert.Equal(t, int64(5), r.N())
+	})
+
+	t.Run("fails after n bytes", func(t *testing.T) {
+		boom := errors.New("boom")
+		b, err := io.ReadAll(NewReader(strings.NewReader("hello world"), FailAfter(3, boom)))
+		assert.ErrorIs(t, err, boom)
+		assert.Equal(t, "hel", string(b))
+	})
+
+	t.Run("chunks reads deterministically", func(t *testing.T) {
+		sizes := func(seed int64) []int {
+			r := NewReader(strings.NewReader(strings.Repeat("x", 100)), WithSeed(seed), WithChunks(8))
+			var sizes []int
+			buf := make([]byte, 64)
+			for {
+				n, err := r.Read(buf)
+				if err != nil {
+					return sizes
+				}
+				assert.LessOrEqual(t, n, 8)
+				sizes = append(sizes, n)
+			}
+		}
+		assert.Equal(t, sizes(7), sizes(7))
+		assert.NotEqual(t, sizes(7), sizes(8))
+	})
+
+	t.Run("fails randomly", func(t *testing.T) {
+		r := NewReader(strings.NewReader(strings.Repeat("x", 100)), WithChunks(1), FailRandomly(0.5, nil))
+		var failed int
+		buf := make([]byte, 1)
+		for r.N() < 100 {
+			_, err := r.Read(buf)
+			if err != nil {
+				assert.ErrorIs(t, err, ErrInjected)
+				failed++
+			}
+		}
+		assert.Greater(t, failed, 0)
+	})
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("writes until failing", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		w := NewWriter(out, FailAfter(4, nil))
+		n, err := w.Write([]byte("hello"))
+		assert.ErrorIs(t, err, ErrInjected)
+		assert.Equal(t, 4, n)
+		assert.Equal(t, "hell", out.String())
+
+		_, err = w.Write([]byte("o"))
+		assert.ErrorIs(t, err, ErrInjected)
+		assert.Equal(t, int64(4), w.N())
+	})
+
+	t.Run("passes on chunked writes", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		n, err := NewWriter(out, WithChunks(3)).Write([]byte("hello world"))
+		assert.NoError(t, err)
+		assert.Equal(t, 11, n)
+		assert.Equal(t, "hello world", out.String())
+	})
+}
+
+func TestLines(t *testing.T) {
+	r := Lines(`{"a":1}`, "{\"b\":2}\n")
+	b, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"a\":1}\n{\"b\":2}\n", string(b))
+}
@@ -0,0 +1,91 @@
+package faultio
+
+import "io"
+
+// Messages as the daemon sends them, for building scripted input.
+const (
+	Initialize        = `{"action":"initialize","shardId":"shardId-000000000000","sequenceNumber":"TRIM_HORIZON","subSequenceNumber":0}`
+	ProcessRecords    = `{"action":"processRecords","millisBehindLatest":0,"records":[{"action":"record","data":"aGVsbG8=","partitionKey":"pk","approximateArrivalTimestamp":1704067200000,"sequenceNumber":"49590338271490256608561711338831091224701278195820789858","subSequenceNumber":0}]}`
+	CheckpointAck     = `{"action":"checkpoint","sequenceNumber":null,"subSequenceNumber":null,"error":""}`
+	ShutdownRequested = `{"action":"shutdownRequested"}`
+)
+
+// MalformedAcks are replies to a checkpoint that are not a valid
+// checkpoint ack, by name. An action in place of an ack is not one of
+// them, since the daemon may request a shutdown while a batch is being
+// processed.
+var MalformedAcks = map[string]string{
+	"truncated":           `{"action":"checkpoint","sequenceNum`,
+	"not json":            `ThrottlingException`,
+	"null":                `null`,
+	"no action":           `{"sequenceNumber":null,"subSequenceNumber":null,"error":""}`,
+	"numeric seq num":     `{"action":"checkpoint","sequenceNumber":1,"error":""}`,
+	"string sub seq num":  `{"action":"checkpoint","subSequenceNumber":"0","error":""}`,
+	"error is not string": `{"action":"checkpoint","error":{"code":"ThrottlingException"}}`,
+}
+
+// Scenario is scripted daemon input with the faults to inject into a
+// Manager's streams. The scripts assume a processor that checkpoints
+// every batch once, e.g. with CheckpointBatch.
+type Scenario struct {
+	Name string
+	// Lines is what the daemon sends, one message per line
+	Lines []string
+	// In and Out are the faults injected into the Manager's input and
+	// output
+	In, Out []Opts
+}
+
+// Streams returns the input and output to hand to kcl.NewManager or
+// kcl.NewMultilangInterface. Whatever gets through to the output is
+// written to out.
+func (s Scenario) Streams(out io.Writer) (*Reader, *Writer) {
+	return NewReader(Lines(s.Lines...), s.In...), NewWriter(out, s.Out...)
+}
+
+// Scenarios returns the standard fault scenarios, with randomness
+// seeded with seed.
+func Scenarios(seed int64) []Scenario {
+	session := []string{Initialize, ProcessRecords, CheckpointAck, ShutdownRequested, CheckpointAck}
+	cut := int64(len(Initialize)+1) + int64(len(ProcessRecords)/2)
+	return []Scenario{
+		{
+			Name:  "clean session in random chunks",
+			Lines: session,
+			In:    []Opts{WithSeed(seed), WithChunks(16)},
+			Out:   []Opts{WithSeed(seed), WithChunks(16)},
+		},
+		{
+			Name:  "clean session in one read",
+			Lines: session,
+		},
+		{
+			Name:  "shutdown requested before checkpoint ack",
+			Lines: []string{Initialize, ProcessRecords, ShutdownRequested, CheckpointAck, CheckpointAck},
+			In:    []Opts{WithSeed(seed), WithChunks(64)},
+		},
+		{
+			Name:  "input truncated mid json",
+			Lines: session,
+			In:    []Opts{Truncate(cut)},
+		},
+		{
+			Name:  "output write fails",
+			Lines: session,
+			Out:   []Opts{FailAfter(0, nil)},
+		},
+		{
+			Name:  "output write fails mid message",
+			Lines: session,
+			Out:   []Opts{FailAfter(10, nil)},
+		},
+		{
+			Name:  "eof during processRecords",
+			Lines: []string{Initialize, ProcessRecords},
+		},
+		{
+			Name:  "malformed checkpoint ack",
+			Lines: []string{Initialize, ProcessRecords, MalformedAcks["no action"]},
+		},
+	}
+}
@@ -0,0 +1,250 @@
+package kcltest
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+)
+
+// Clock is a fake clock for record arrival timestamps. It only moves
+// when told to.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock creates a Clock set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the clock's current time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// seqNumBase is a realistic 56 digit Kinesis sequence number that
+// generated sequence numbers count up from.
+var seqNumBase, _ = new(big.Int).SetString("49590338271490256608559692538361571095921575989136588898", 10)
+
+// seqNumStep keeps generated sequence numbers far apart like real ones
+// are, while leaving room for billions of records before they grow a
+// digit.
+var seqNumStep = big.NewInt(1 << 40)
+
+// Shard builds records for a single shard, with sequence numbers that
+// increase monotonically across every record it builds.
+type Shard struct {
+	// ID is the shard ID, e.g. for Daemon.Initialize
+	ID string
+
+	mu     sync.Mutex
+	clock  *Clock
+	tick   time.Duration
+	seqNum *big.Int
+	count  int
+}
+
+type ShardOpts func(s *Shard)
+
+// WithClock sets the clock arrival timestamps are taken from. By
+// default every Shard has its own clock starting at 2024-01-01 UTC.
+func WithClock(c *Clock) ShardOpts {
+	return func(s *Shard) {
+		s.clock = c
+	}
+}
+
+// WithTick advances the shard's clock by d after every record built.
+func WithTick(d time.Duration) ShardOpts {
+	return func(s *Shard) {
+		s.tick = d
+	}
+}
+
+// NewShard creates a Shard with the given ID. Sequence numbers of
+// different shards start at different points, like they do in Kinesis.
+func NewShard(id string, opts ...ShardOpts) *Shard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	offset := new(big.Int).Lsh(big.NewInt(int64(h.Sum32())), 80)
+	s := &Shard{
+		ID:     id,
+		clock:  NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+		seqNum: offset.Add(offset, seqNumBase),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Clock returns the clock the shard takes arrival timestamps from.
+func (s *Shard) Clock() *Clock {
+	return s.clock
+}
+
+// RecordOpts customize a single built record.
+type RecordOpts func(r *actions.Record)
+
+// WithPartitionKey sets the record's partition key. It defaults to
+// "partitionKey-<n>" where n counts the shard's records.
+func WithPartitionKey(key string) RecordOpts {
+	return func(r *actions.Record) {
+		r.PartitionKey = key
+	}
+}
+
+// WithArrival overrides the record's approximate arrival timestamp.
+func WithArrival(t time.Time) RecordOpts {
+	return func(r *actions.Record) {
+		r.ApproximateArrivalTimestamp = int(t.UnixMilli())
+	}
+}
+
+// next returns the next sequence number and arrival time. Callers must
+// hold s.mu.
+func (s *Shard) next() (string, time.Time) {
+	s.seqNum.Add(s.seqNum, seqNumStep)
+	arrival := s.clock.Now()
+	if s.tick > 0 {
+		s.clock.Advance(s.tick)
+	}
+	s.count++
+	return s.seqNum.String(), arrival
+}
+
+func (s *Shard) build(seqNum string, subSeqNum int, arrival time.Time, data []byte, opts []RecordOpts) actions.Record {
+	r := actions.Record{
+		Action:                      "record",
+		Data:                        base64.StdEncoding.EncodeToString(data),
+		PartitionKey:                fmt.Sprintf("partitionKey-%d", s.count),
+		ApproximateArrivalTimestamp: int(arrival.UnixMilli()),
+		SequenceNumber:              seqNum,
+		SubSequenceNumber:           subSeqNum,
+	}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	return r
+}
+
+// Record builds a record holding data.
+func (s *Shard) Record(data []byte, opts ...RecordOpts) actions.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seqNum, arrival := s.next()
+	return s.build(seqNum, 0, arrival, data, opts)
+}
+
+// JSONRecord builds a record holding v encoded as json. It panics if v
+// cannot be encoded.
+func (s *Shard) JSONRecord(v any, opts ...RecordOpts) actions.Record {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("kcltest: error encoding record data: %v", err))
+	}
+	return s.Record(data, opts...)
+}
+
+// Records builds a record for every data.
+func (s *Shard) Records(data ...[]byte) []actions.Record {
+	records := make([]actions.Record, len(data))
+	for i, d := range data {
+		records[i] = s.Record(d)
+	}
+	return records
+}
+
+// StringRecords builds a record for every string.
+func (s *Shard) StringRecords(data ...string) []actions.Record {
+	records := make([]actions.Record, len(data))
+	for i, d := range data {
+		records[i] = s.Record([]byte(d))
+	}
+	return records
+}
+
+// Batch wraps records in a processRecords action. MillisBehindLatest is
+// set to how far the last record's arrival is behind the shard's clock.
+func (s *Shard) Batch(records ...actions.Record) actions.ProcessAction {
+	a := actions.ProcessAction{Action: actions.PROCESS_RECORDS, Records: records}
+	if len(records) > 0 {
+		last := time.UnixMilli(int64(records[len(records)-1].ApproximateArrivalTimestamp))
+		a.MillisBehindLatest = max(int(s.clock.Now().Sub(last).Milliseconds()), 0)
+	}
+	return a
+}
+
+// Deaggregated builds the records KCL hands to the processor for a
+// single KPL aggregated record holding data: they share one sequence
+// number and are told apart by their sub sequence numbers.
+func (s *Shard) Deaggregated(data ...[]byte) []actions.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seqNum, arrival := s.next()
+	records := make([]actions.Record, len(data))
+	for i, d := range data {
+		records[i] = s.build(seqNum, i, arrival, d, nil)
+	}
+	return records
+}
+
+// Aggregated builds a single record whose data is the KPL aggregated
+// record format holding each of data, all with partitionKey. This is
+// what a processor sees if deaggregation is left to it.
+func (s *Shard) Aggregated(partitionKey string, data ...[]byte) actions.Record {
+	return s.Record(AggregateKPL(partitionKey, data...), WithPartitionKey(partitionKey))
+}
+
+// kplMagic prefixes every KPL aggregated record.
+var kplMagic = []byte{0xf3, 0x89, 0x9a, 0xc2}
+
+// AggregateKPL encodes data as a KPL aggregated record: the magic
+// bytes, an AggregatedRecord protobuf message and its md5 checksum.
+func AggregateKPL(partitionKey string, data ...[]byte) []byte {
+	// AggregatedRecord {
+	//   repeated string partition_key_table = 1;
+	//   repeated Record records = 3;
+	// }
+	// Record {
+	//   required uint64 partition_key_index = 1;
+	//   required bytes data = 3;
+	// }
+	var msg []byte
+	msg = appendProtoBytes(msg, 1, []byte(partitionKey))
+	for _, d := range data {
+		var rec []byte
+		rec = binary.AppendUvarint(rec, 1<<3|0) // partition_key_index, varint
+		rec = binary.AppendUvarint(rec, 0)
+		rec = appendProtoBytes(rec, 3, d)
+		msg = appendProtoBytes(msg, 3, rec)
+	}
+	sum := md5.Sum(msg)
+	out := append(append([]byte(nil), kplMagic...), msg...)
+	return append(out, sum[:]...)
+}
+
+// appendProtoBytes appends a length delimited protobuf field.
+func appendProtoBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
@@ -0,0 +1,97 @@
+package kcltest
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShard(t *testing.T) {
+	t.Run("builds records with increasing sequence numbers", func(t *testing.T) {
+		s := NewShard("shardId-000")
+		records := s.StringRecords("a", "b", "c")
+		for i, r := range records {
+			assert.Len(t, r.SequenceNumber, 56)
+			if i > 0 {
+				assert.Less(t, records[i-1].SequenceNumber, r.SequenceNumber)
+			}
+		}
+		assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("b")), records[1].Data)
+		assert.Equal(t, "partitionKey-2", records[1].PartitionKey)
+
+		other := NewShard("shardId-001").Record([]byte("a"))
+		assert.NotEqual(t, records[0].SequenceNumber, other.SequenceNumber)
+	})
+
+	t.Run("takes arrival timestamps from clock", func(t *testing.T) {
+		start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+		clock := NewClock(start)
+		s := NewShard("shardId-000", WithClock(clock), WithTick(time.Second))
+		records := s.Records([]byte("a"), []byte("b"))
+		assert.Equal(t, int(start.UnixMilli()), records[0].ApproximateArrivalTimestamp)
+		assert.Equal(t, int(start.Add(time.Second).UnixMilli()), records[1].ApproximateArrivalTimestamp)
+
+		clock.Advance(time.Minute)
+		batch := s.Batch(records...)
+		assert.Equal(t, actions.PROCESS_RECORDS, batch.Action)
+		// the clock ticked past the last record before advancing
+		assert.Equal(t, 61000, batch.MillisBehindLatest)
+
+		r := s.JSONRecord(map[string]string{"type": "order"}, WithPartitionKey("order-1"), WithArrival(start))
+		assert.Equal(t, base64.StdEncoding.EncodeToString([]byte(`{"type":"order"}`)), r.Data)
+		assert.Equal(t, "order-1", r.PartitionKey)
+		assert.Equal(t, int(start.UnixMilli()), r.ApproximateArrivalTimestamp)
+	})
+
+	t.Run("builds deaggregated records", func(t *testing.T) {
+		s := NewShard("shardId-000")
+		records := s.Deaggregated([]byte("a"), []byte("b"), []byte("c"))
+		for i, r := range records {
+			assert.Equal(t, records[0].SequenceNumber, r.SequenceNumber)
+			assert.Equal(t, i, r.SubSequenceNumber)
+		}
+		assert.Less(t, records[0].SequenceNumber, s.Record(nil).SequenceNumber)
+	})
+
+	t.Run("builds kpl aggregated records", func(t *testing.T) {
+		s := NewShard("shardId-000")
+		r := s.Aggregated("pk", []byte("a"), []byte("bc"))
+		data, err := base64.StdEncoding.DecodeString(r.Data)
+		assert.NoError(t, err)
+		assert.Equal(t, "pk", r.PartitionKey)
+
+		assert.Equal(t, kplMagic, data[:4])
+		msg := data[4 : len(data)-md5.Size]
+		sum := md5.Sum(msg)
+		assert.Equal(t, sum[:], data[len(data)-md5.Size:])
+		assert.Equal(t, []byte{
+			0x0a, 0x02, 'p', 'k', // partition_key_table
+			0x1a, 0x05, 0x08, 0x00, 0x1a, 0x01, 'a', // records[0]
+			0x1a, 0x06, 0x08, 0x00, 0x1a, 0x02, 'b', 'c', // records[1]
+		}, msg)
+	})
+
+	t.Run("feeds fake daemon", func(t *testing.T) {
+		var got [][]byte
+		rp := &kcl.RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				for _, r := range records {
+					data, _ := base64.StdEncoding.DecodeString(r.Data)
+					got = append(got, data)
+				}
+				return cp.CheckpointBatch()
+			},
+		}
+		s := NewShard("shardId-000")
+		d := NewDaemon(t, rp, quiet)
+		d.Initialize(s.ID).ProcessBatch(s.Batch(s.StringRecords("hello", "world")...))
+		assert.Equal(t, [][]byte{[]byte("hello"), []byte("world")}, got)
+		assert.Len(t, d.Checkpoints(), 1)
+	})
+}
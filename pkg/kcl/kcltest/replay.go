@@ -0,0 +1,227 @@
+package kcltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/wiretap"
+)
+
+// Replay drives the processor through a transcript recorded with a
+// wiretap.Recorder, e.g. from a real daemon session. Every inbound
+// message (actions and checkpoint acks) is sent as recorded, then the
+// messages the processor sent are compared to the recorded outbound
+// ones and any difference fails the test with a diff. Messages are
+// compared as json, so key order and whitespace do not matter.
+//
+// With WithTranscriptUpdate the transcript is rewritten with what the
+// processor sent instead. Replay closes the processor's input once
+// the transcript is done, so it must be the last action sent.
+func (d *Daemon) Replay(path string) *Daemon {
+	d.t.Helper()
+	if d.exited {
+		d.t.Fatalf("kcltest: cannot replay %s, manager already exited: %v", path, d.err)
+		return d
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		d.t.Fatalf("kcltest: error opening transcript: %v", err)
+		return d
+	}
+	entries, err := wiretap.ReadEntries(f)
+	f.Close()
+	if err != nil {
+		d.t.Fatalf("kcltest: error reading transcript %s: %v", path, err)
+		return d
+	}
+
+	// inbound messages are written in order by a single goroutine, since
+	// the manager only reads them when it wants the next one
+	inbound := make(chan []byte, len(entries))
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for line := range inbound {
+			d.stdin.Write(line)
+		}
+	}()
+
+	var (
+		replayed []wiretap.Entry
+		want     []string
+		got      []string
+		pending  []int
+		stalled  bool
+	)
+	received := func(e wiretap.Entry, msg message) {
+		e.Message = msg.raw
+		replayed = append(replayed, e)
+		got = append(got, canonical(msg.raw))
+		switch msg.Action {
+		case "status":
+			d.statuses = append(d.statuses, msg.ResponseFor)
+		case "checkpoint":
+			pending = append(pending, len(d.checkpoints))
+			d.checkpoints = append(d.checkpoints, Checkpoint{SeqNum: msg.SeqNum, SubSeqNum: msg.SubSeqNum})
+		}
+	}
+	for _, e := range entries {
+		switch e.Direction {
+		case wiretap.In:
+			replayed = append(replayed, e)
+			var ack checkpointAck
+			json.Unmarshal(e.Message, &ack)
+			if ack.Action == "checkpoint" && len(pending) > 0 {
+				d.checkpoints[pending[0]].Response = ack.Error
+				pending = pending[1:]
+			}
+			inbound <- append(inboundLine(e.Message), '\n')
+		case wiretap.Out:
+			want = append(want, canonical(e.Message))
+			if stalled {
+				continue
+			}
+			select {
+			case msg, ok := <-d.msgs:
+				if !ok {
+					// the manager exited, everything else recorded is missing
+					stalled = true
+					continue
+				}
+				received(e, msg)
+			case <-time.After(d.timeout):
+				stalled = true
+			}
+		}
+	}
+
+	// let the manager read what is left of the transcript, then close its
+	// input. Anything sent after that was not recorded.
+	last := wiretap.Entry{Direction: wiretap.Out}
+	if len(entries) > 0 {
+		last.Time = entries[len(entries)-1].Time
+	}
+	close(inbound)
+	timeout := time.After(d.timeout)
+	for written != nil {
+		select {
+		case <-written:
+			written = nil
+		case msg, ok := <-d.msgs:
+			if !ok {
+				written = nil
+				continue
+			}
+			received(last, msg)
+		case <-timeout:
+			stalled = true
+			written = nil
+		}
+	}
+	d.stdin.Close()
+	for msg := range d.msgs {
+		received(last, msg)
+	}
+	d.exit()
+
+	if d.update {
+		err := writeTranscript(path, replayed)
+		if err != nil {
+			d.t.Fatalf("kcltest: error updating transcript: %v", err)
+		}
+		return d
+	}
+	if diff := lineDiff(want, got); diff != "" {
+		if stalled {
+			d.t.Errorf("kcltest: processor stopped responding while replaying %s", path)
+		}
+		d.t.Errorf("kcltest: replay of %s differs (-recorded +replayed):\n%s", path, diff)
+	}
+	return d
+}
+
+// inboundLine returns the line a recorded message was sent as. Lines
+// that were not json were recorded as json strings.
+func inboundLine(msg json.RawMessage) []byte {
+	var s string
+	if json.Unmarshal(msg, &s) == nil {
+		return []byte(s)
+	}
+	return msg
+}
+
+// canonical re-encodes a json message with sorted keys so messages can
+// be compared as text.
+func canonical(msg json.RawMessage) string {
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	dec.UseNumber()
+	var v any
+	if dec.Decode(&v) != nil {
+		return string(msg)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return string(msg)
+	}
+	return string(b)
+}
+
+func writeTranscript(path string, entries []wiretap.Entry) error {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(b, '\n'))
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// lineDiff returns a unified style diff of two sequences of lines, or ""
+// if they are equal.
+func lineDiff(a, b []string) string {
+	// lcs[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	changed := false
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			fmt.Fprintf(&sb, "  %s\n", a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&sb, "- %s\n", a[i])
+			changed = true
+			i++
+		default:
+			fmt.Fprintf(&sb, "+ %s\n", b[j])
+			changed = true
+			j++
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return sb.String()
+}
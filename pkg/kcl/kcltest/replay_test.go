@@ -0,0 +1,98 @@
+package kcltest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+// retryingProcessor checkpoints every batch with try, retrying
+// once if the daemon answers with an error.
+func retryingProcessor(try func(records []actions.Record, cp *checkpoint.Checkpointer) error) *kcl.RecordProcessorFuncs {
+	return &kcl.RecordProcessorFuncs{
+		ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+			if err := try(records, cp); err != nil {
+				return try(records, cp)
+			}
+			return nil
+		},
+	}
+}
+
+func checkpointLast(records []actions.Record, cp *checkpoint.Checkpointer) error {
+	return cp.CheckpointSeqNum(records[len(records)-1].SequenceNumber)
+}
+
+func checkpointBatch(records []actions.Record, cp *checkpoint.Checkpointer) error {
+	return cp.CheckpointBatch()
+}
+
+// errorsTB records errors instead of failing the test.
+type errorsTB struct {
+	testing.TB
+	errs []string
+}
+
+func (tb *errorsTB) Errorf(format string, args ...any) {
+	tb.errs = append(tb.errs, fmt.Sprintf(format, args...))
+}
+
+func TestReplay(t *testing.T) {
+	t.Run("replays recorded session", func(t *testing.T) {
+		d := NewDaemon(t, retryingProcessor(checkpointLast), quiet)
+		d.Replay("testdata/session.ndjson")
+
+		assert.True(t, d.Exited())
+		assert.NoError(t, d.Err())
+		assert.Equal(t, []string{actions.INITITALIZE, actions.PROCESS_RECORDS, actions.PROCESS_RECORDS, actions.SHUTDOWN_REQUESTED}, d.Statuses())
+		cps := d.Checkpoints()
+		if assert.Len(t, cps, 4) {
+			assert.Equal(t, Throttling, cps[1].Response)
+			assert.Equal(t, Success, cps[2].Response)
+		}
+	})
+
+	t.Run("reports differences as diff", func(t *testing.T) {
+		tb := &errorsTB{TB: t}
+		d := NewDaemon(tb, retryingProcessor(checkpointBatch), quiet)
+		d.Replay("testdata/session.ndjson")
+
+		if assert.Len(t, tb.errs, 1) {
+			diff := tb.errs[0]
+			assert.Contains(t, diff, "differs (-recorded +replayed)")
+			assert.Contains(t, diff, `  {"action":"status","responseFor":"initialize"}`)
+			assert.Contains(t, diff, `- {"action":"checkpoint","sequenceNumber":"49590338271490256608561711338831091224701279295332417634"}`)
+			assert.Contains(t, diff, `+ {"action":"checkpoint"}`)
+		}
+	})
+
+	t.Run("updates transcript", func(t *testing.T) {
+		b, err := os.ReadFile("testdata/session.ndjson")
+		assert.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "session.ndjson")
+		assert.NoError(t, os.WriteFile(path, b, 0o644))
+
+		NewDaemon(t, retryingProcessor(checkpointBatch), quiet, WithTranscriptUpdate(true)).Replay(path)
+
+		updated, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, strings.Count(string(b), "\n"), strings.Count(string(updated), "\n"))
+		assert.Equal(t, 3, strings.Count(string(updated), `"direction":"out","message":{"action":"checkpoint"}`))
+
+		tb := &errorsTB{TB: t}
+		NewDaemon(tb, retryingProcessor(checkpointBatch), quiet).Replay(path)
+		assert.Empty(t, tb.errs)
+	})
+}
+
+func TestLineDiff(t *testing.T) {
+	assert.Equal(t, "", lineDiff([]string{"a", "b"}, []string{"a", "b"}))
+	assert.Equal(t, "  a\n- b\n+ c\n  d\n+ e\n", lineDiff([]string{"a", "b", "d"}, []string{"a", "c", "d", "e"}))
+}
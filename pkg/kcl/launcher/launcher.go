@@ -0,0 +1,274 @@
+// Package launcher starts the Java KCL MultiLangDaemon for a properties
+// file, like the Makefile's run targets do, after checking everything it
+// needs is in place so mistakes show up before the JVM starts.
+package launcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/internal/prefixio"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/properties"
+)
+
+// MainClass is the class running the MultiLangDaemon.
+const MainClass = "software.amazon.kinesis.multilang.MultiLangDaemon"
+
+// Launcher runs the MultiLangDaemon as a child process.
+type Launcher struct {
+	properties string
+	java       string
+	javaArgs   []string
+	jarsDir    string
+	logback    string
+	// logbackSet records whether logback was chosen by the user, a
+	// missing default is not an error
+	logbackSet bool
+	stdout     io.Writer
+	stderr     io.Writer
+	prefix     string
+	loggr      *slog.Logger
+}
+
+type LauncherOpts func(l *Launcher)
+
+// WithJava sets the java executable. It defaults to $JAVA_HOME/bin/java
+// when JAVA_HOME is set, and java from the PATH otherwise.
+func WithJava(path string) LauncherOpts {
+	return func(l *Launcher) {
+		l.java = path
+	}
+}
+
+// WithJavaArgs adds JVM options, e.g. -Xmx512m.
+func WithJavaArgs(args ...string) LauncherOpts {
+	return func(l *Launcher) {
+		l.javaArgs = append(l.javaArgs, args...)
+	}
+}
+
+// WithJarsDir sets the directory holding the KCL jars and their
+// dependencies, which make up the classpath. It defaults to ./jars,
+// where `make install_jars` puts them.
+func WithJarsDir(dir string) LauncherOpts {
+	return func(l *Launcher) {
+		l.jarsDir = dir
+	}
+}
+
+// WithLogbackConfig sets the logback configuration file for the daemon.
+// It defaults to ./logback.xml if there is one.
+func WithLogbackConfig(path string) LauncherOpts {
+	return func(l *Launcher) {
+		l.logback = path
+		l.logbackSet = true
+	}
+}
+
+// WithOutput sets where the daemon's stdout and stderr are streamed to,
+// by default os.Stdout and os.Stderr.
+func WithOutput(stdout, stderr io.Writer) LauncherOpts {
+	return func(l *Launcher) {
+		l.stdout = stdout
+		l.stderr = stderr
+	}
+}
+
+// WithLogPrefix sets the prefix of every line the daemon logs. It
+// defaults to "[multilang] ".
+func WithLogPrefix(prefix string) LauncherOpts {
+	return func(l *Launcher) {
+		l.prefix = prefix
+	}
+}
+
+// WithLauncherLogger sets the logger for the launcher's own messages.
+func WithLauncherLogger(loggr *slog.Logger) LauncherOpts {
+	return func(l *Launcher) {
+		l.loggr = loggr
+	}
+}
+
+// New creates a Launcher for the properties file at path.
+func New(path string, opts ...LauncherOpts) *Launcher {
+	l := &Launcher{
+		properties: path,
+		jarsDir:    "jars",
+		logback:    "logback.xml",
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
+		prefix:     "[multilang] ",
+		loggr:      slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Check validates the properties file and checks its executableName can
+// be run, returning the config. Warnings about the properties file are
+// logged.
+func (l *Launcher) Check() (*properties.Config, error) {
+	p, err := properties.Load(l.properties)
+	if err != nil {
+		return nil, err
+	}
+	c, issues := properties.Lint(p)
+	var errs []properties.Issue
+	for _, issue := range issues {
+		if issue.Severity == properties.Warning {
+			l.loggr.Warn("suspicious setting in properties file",
+				"path", l.properties,
+				"issue", issue.String(),
+			)
+			continue
+		}
+		errs = append(errs, issue)
+	}
+	if len(errs) > 0 {
+		return c, fmt.Errorf("%s:\n%w", l.properties, &properties.ValidationError{Issues: errs})
+	}
+
+	// the daemon runs executableName from its working directory, which
+	// is ours
+	exe := strings.Fields(c.ExecutableName)[0]
+	path, err := exec.LookPath(exe)
+	if err != nil {
+		return c, fmt.Errorf("executableName %q cannot be run: %w", exe, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return c, fmt.Errorf("executableName %q cannot be run: %w", exe, err)
+	}
+	if info.IsDir() {
+		return c, fmt.Errorf("executableName %q is a directory", exe)
+	}
+	return c, nil
+}
+
+// Classpath returns the classpath made of every jar in the jars
+// directory, in name order.
+func (l *Launcher) Classpath() (string, error) {
+	jars, err := filepath.Glob(filepath.Join(l.jarsDir, "*.jar"))
+	if err != nil {
+		return "", err
+	}
+	if len(jars) == 0 {
+		return "", fmt.Errorf("no jars in %s, install them with `make install_jars`", l.jarsDir)
+	}
+	slices.Sort(jars)
+	return strings.Join(jars, string(os.PathListSeparator)), nil
+}
+
+// Command checks everything is in place and returns the command
+// starting the daemon, without starting it.
+func (l *Launcher) Command(ctx context.Context) (*exec.Cmd, error) {
+	_, err := l.Check()
+	if err != nil {
+		return nil, err
+	}
+	classpath, err := l.Classpath()
+	if err != nil {
+		return nil, err
+	}
+	java, err := l.javaPath()
+	if err != nil {
+		return nil, err
+	}
+	args := slices.Clone(l.javaArgs)
+	if _, err := os.Stat(l.logback); err == nil {
+		args = append(args, "-Dlogback.configurationFile="+l.logback)
+	} else if l.logbackSet {
+		return nil, fmt.Errorf("logback config: %w", err)
+	}
+	args = append(args, "-cp", classpath, MainClass, l.properties)
+	return exec.CommandContext(ctx, java, args...), nil
+}
+
+func (l *Launcher) javaPath() (string, error) {
+	java := l.java
+	if java == "" {
+		java = "java"
+		if home := os.Getenv("JAVA_HOME"); home != "" {
+			java = filepath.Join(home, "bin", "java")
+		}
+	}
+	path, err := exec.LookPath(java)
+	if err != nil {
+		return "", fmt.Errorf("java not found, install a JDK or set JAVA_HOME: %w", err)
+	}
+	return path, nil
+}
+
+// ExitError is returned when the daemon exits with a non zero status.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("multilang daemon exited with status %d", e.Code)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// Run starts the daemon and waits for it to exit. Every signal received
+// on signals is forwarded to it, so the KCL can shut down gracefully,
+// and cancelling ctx kills it. It runs in a process group of its own,
+// so a Ctrl-C in the terminal reaches it once, through signals. Its
+// output is streamed with every line prefixed.
+func (l *Launcher) Run(ctx context.Context, signals <-chan os.Signal) error {
+	cmd, err := l.Command(ctx)
+	if err != nil {
+		return err
+	}
+	var mu sync.Mutex
+	stdout := prefixio.NewWriter(l.stdout, &mu, l.prefix)
+	stderr := prefixio.NewWriter(l.stderr, &mu, l.prefix)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	ownProcessGroup(cmd)
+	l.loggr.Info("starting multilang daemon", "properties", l.properties, "java", cmd.Path)
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("error starting multilang daemon: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				l.loggr.Info("forwarding signal to multilang daemon", "signal", sig)
+				err := cmd.Process.Signal(sig)
+				if err != nil {
+					l.loggr.Error("error forwarding signal", "signal", sig, "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	err = cmd.Wait()
+	close(done)
+	stdout.Flush()
+	stderr.Flush()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitError{Code: exitErr.ExitCode(), Err: err}
+	}
+	return err
+}
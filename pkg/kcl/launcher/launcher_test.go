@@ -0,0 +1,198 @@
+package launcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// javaEnv makes the test binary run as a fake java, so the tests can
+// launch it like the real daemon.
+const javaEnv = "LAUNCHER_TEST_JAVA"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(javaEnv); mode != "" {
+		os.Exit(runFakeJava(mode))
+	}
+	os.Exit(m.Run())
+}
+
+// runFakeJava prints its arguments and exits with status 3, or in mode
+// "wait" waits for SIGTERM and exits cleanly.
+func runFakeJava(mode string) int {
+	terminated := make(chan os.Signal, 1)
+	signal.Notify(terminated, syscall.SIGTERM)
+	fmt.Printf("args: %s\n", strings.Join(os.Args[1:], " "))
+	fmt.Fprint(os.Stderr, "daemon starting")
+	if mode != "wait" {
+		return 3
+	}
+	fmt.Printf("ready, pid %d\n", os.Getpid())
+	<-terminated
+	fmt.Println("shutting down gracefully")
+	return 0
+}
+
+// syncBuffer is a bytes.Buffer safe to read while the daemon writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// setup creates a jars directory, a processor and a properties file
+// for it in a temporary directory, and returns the properties file.
+func setup(t *testing.T, props string) (dir, path string) {
+	dir = t.TempDir()
+	jars := filepath.Join(dir, "jars")
+	assert.NoError(t, os.Mkdir(jars, 0o755))
+	for _, jar := range []string{"b.jar", "a.jar", "README"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(jars, jar), nil, 0o644))
+	}
+	processor := filepath.Join(dir, "processor")
+	assert.NoError(t, os.WriteFile(processor, []byte("#!/bin/sh\n"), 0o755))
+	if props == "" {
+		props = fmt.Sprintf("executableName = %s --verbose\nstreamName = s\napplicationName = a\n", processor)
+	}
+	path = filepath.Join(dir, "kcl.properties")
+	assert.NoError(t, os.WriteFile(path, []byte(props), 0o644))
+	return dir, path
+}
+
+func fakeJava(t *testing.T, mode string) string {
+	t.Setenv(javaEnv, mode)
+	return os.Args[0]
+}
+
+var quiet = WithLauncherLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+func TestCommand(t *testing.T) {
+	t.Run("builds daemon command line", func(t *testing.T) {
+		dir, path := setup(t, "")
+		logback := filepath.Join(dir, "logback.xml")
+		assert.NoError(t, os.WriteFile(logback, nil, 0o644))
+		l := New(path, quiet,
+			WithJava(fakeJava(t, "exit")),
+			WithJarsDir(filepath.Join(dir, "jars")),
+			WithLogbackConfig(logback),
+			WithJavaArgs("-Xmx512m"),
+		)
+
+		cmd, err := l.Command(context.Background())
+		assert.NoError(t, err)
+		classpath := filepath.Join(dir, "jars", "a.jar") + string(os.PathListSeparator) + filepath.Join(dir, "jars", "b.jar")
+		assert.Equal(t, []string{
+			os.Args[0],
+			"-Xmx512m",
+			"-Dlogback.configurationFile=" + logback,
+			"-cp", classpath,
+			MainClass,
+			path,
+		}, cmd.Args)
+	})
+
+	t.Run("skips missing default logback config", func(t *testing.T) {
+		dir, path := setup(t, "")
+		t.Chdir(dir)
+		cmd, err := New(path, quiet, WithJava(fakeJava(t, "exit"))).Command(context.Background())
+		assert.NoError(t, err)
+		assert.NotContains(t, strings.Join(cmd.Args, " "), "-Dlogback")
+	})
+
+	t.Run("reports what is missing", func(t *testing.T) {
+		dir, _ := setup(t, "")
+		java := fakeJava(t, "exit")
+		processor := filepath.Join(dir, "processor")
+		cases := []struct {
+			name  string
+			props string
+			opts  []LauncherOpts
+			err   string
+		}{
+			{"invalid properties", "executableName = " + processor + "\napplicationName = a\nmaxRecords = x\n", nil,
+				"streamName: must be set, or streamArn\nline 3: maxRecords: must be a whole number, got \"x\""},
+			{"missing processor", "executableName = " + processor + "-missing\nstreamName = s\napplicationName = a\n", nil,
+				fmt.Sprintf("executableName %q cannot be run", processor+"-missing")},
+			{"no jars", "", []LauncherOpts{WithJarsDir(dir)},
+				"no jars in " + dir + ", install them with `make install_jars`"},
+			{"no java", "", []LauncherOpts{WithJava(filepath.Join(dir, "java"))},
+				"java not found, install a JDK or set JAVA_HOME"},
+			{"missing logback config", "", []LauncherOpts{WithLogbackConfig(filepath.Join(dir, "logback.xml"))},
+				"logback config"},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				_, path := setup(t, c.props)
+				opts := append([]LauncherOpts{quiet, WithJava(java), WithJarsDir(filepath.Join(dir, "jars"))}, c.opts...)
+				_, err := New(path, opts...).Command(context.Background())
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), c.err)
+				}
+			})
+		}
+	})
+}
+
+func TestRun(t *testing.T) {
+	t.Run("streams prefixed output and exit status", func(t *testing.T) {
+		dir, path := setup(t, "")
+		var out syncBuffer
+		l := New(path, quiet,
+			WithJava(fakeJava(t, "exit")),
+			WithJarsDir(filepath.Join(dir, "jars")),
+			WithOutput(&out, &out),
+			WithLogPrefix("[daemon] "),
+		)
+
+		err := l.Run(context.Background(), nil)
+		var exitErr *ExitError
+		if assert.ErrorAs(t, err, &exitErr) {
+			assert.Equal(t, 3, exitErr.Code)
+		}
+		assert.Contains(t, out.String(), "[daemon] args: ")
+		assert.Contains(t, out.String(), "[daemon] daemon starting\n")
+	})
+
+	t.Run("forwards signals", func(t *testing.T) {
+		dir, path := setup(t, "")
+		var out syncBuffer
+		l := New(path, quiet,
+			WithJava(fakeJava(t, "wait")),
+			WithJarsDir(filepath.Join(dir, "jars")),
+			WithOutput(&out, &out),
+		)
+		signals := make(chan os.Signal, 1)
+		go func() {
+			for !strings.Contains(out.String(), "ready") {
+				time.Sleep(10 * time.Millisecond)
+			}
+			signals <- syscall.SIGTERM
+		}()
+
+		assert.NoError(t, l.Run(context.Background(), signals))
+		assert.Contains(t, out.String(), "[multilang] shutting down gracefully\n")
+	})
+}
@@ -0,0 +1,53 @@
+//go:build unix
+
+package launcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunProcessGroup(t *testing.T) {
+	t.Run("starts daemon in its own process group", func(t *testing.T) {
+		dir, path := setup(t, "")
+		var out syncBuffer
+		l := New(path, quiet,
+			WithJava(fakeJava(t, "wait")),
+			WithJarsDir(filepath.Join(dir, "jars")),
+			WithOutput(&out, &out),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		ready := regexp.MustCompile(`ready, pid (\d+)`)
+		signals := make(chan os.Signal, 1)
+		pgid := make(chan int, 1)
+		go func() {
+			m := ready.FindStringSubmatch(out.String())
+			for m == nil {
+				if ctx.Err() != nil {
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+				m = ready.FindStringSubmatch(out.String())
+			}
+			pid, _ := strconv.Atoi(m[1])
+			group, err := syscall.Getpgid(pid)
+			if err != nil {
+				group = -1
+			}
+			pgid <- group - pid
+			signals <- syscall.SIGTERM
+		}()
+
+		assert.NoError(t, l.Run(ctx, signals))
+		assert.Zero(t, <-pgid, "daemon is not its process group leader")
+	})
+}
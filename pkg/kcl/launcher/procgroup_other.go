@@ -0,0 +1,8 @@
+//go:build !unix
+
+package launcher
+
+import "os/exec"
+
+// ownProcessGroup does nothing where there are no process groups.
+func ownProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package launcher
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// ownProcessGroup starts cmd in a process group of its own, so a Ctrl-C
+// in the terminal reaches it only through Run forwarding it.
+func ownProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,89 @@
+package kcl
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+)
+
+// LoggerSetter is implemented by RecordProcessors that want the
+// manager's logger. SetLogger is called before every lifecycle call
+// with a logger carrying the shard ID, worker PID and current action,
+// so logs from the many child processes KCL runs can be told apart.
+type LoggerSetter interface {
+	SetLogger(l *slog.Logger)
+}
+
+// WithRecordLogSampling sets how often the manager writes a debug log
+// line for an individual record: one in every n records is logged. The
+// default of 1 logs every record, and n below 1 turns per record logs
+// off. Batch level log lines are never sampled.
+func WithRecordLogSampling(n int) ManagerOpts {
+	return func(kclm *Manager) {
+		kclm.recordLogEvery = n
+	}
+}
+
+// Logger returns the logger of the action currently being handled, or
+// the shard's logger between actions. It carries the shard ID (once the
+// shard is initialized), the worker PID and the action type.
+func (kclm *Manager) Logger() *slog.Logger {
+	kclm.mu.Lock()
+	defer kclm.mu.Unlock()
+	return kclm.loggr
+}
+
+// setShardLogger derives the logger used between actions from the
+// user's logger. It is called with an empty shardId until the
+// initialize action arrives.
+func (kclm *Manager) setShardLogger(shardId string) {
+	attrs := []any{"worker_pid", os.Getpid()}
+	if shardId != "" {
+		attrs = append(attrs, "shard_id", shardId)
+	}
+	kclm.mu.Lock()
+	kclm.shardLoggr = kclm.baseLoggr.With(attrs...)
+	kclm.loggr = kclm.shardLoggr
+	kclm.mu.Unlock()
+}
+
+// setActionLogger scopes the logger to actionType until the action is
+// handled. An empty actionType goes back to the shard's logger.
+func (kclm *Manager) setActionLogger(actionType string) {
+	kclm.mu.Lock()
+	kclm.loggr = kclm.shardLoggr
+	if actionType != "" {
+		kclm.loggr = kclm.shardLoggr.With("action", actionType)
+	}
+	kclm.mu.Unlock()
+}
+
+// batchLogAttrs describes a batch of records for batch level log lines.
+func batchLogAttrs(records []actions.Record) []any {
+	attrs := []any{"records", len(records)}
+	if len(records) > 0 {
+		attrs = append(attrs,
+			"first_seq_num", records[0].SequenceNumber,
+			"last_seq_num", records[len(records)-1].SequenceNumber,
+		)
+	}
+	return attrs
+}
+
+// logRecords writes the sampled per record debug log lines of a batch.
+func (kclm *Manager) logRecords(records []actions.Record) {
+	if kclm.recordLogEvery < 1 {
+		return
+	}
+	for _, r := range records {
+		if kclm.recordsSeen%kclm.recordLogEvery == 0 {
+			kclm.loggr.Debug("received record",
+				"seq_num", r.SequenceNumber,
+				"sub_seq_num", r.SubSequenceNumber,
+				"partition_key", r.PartitionKey,
+			)
+		}
+		kclm.recordsSeen++
+	}
+}
@@ -0,0 +1,109 @@
+package kcl
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if l == "" {
+			continue
+		}
+		var line map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(l), &line))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func linesWithMsg(lines []map[string]any, msg string) []map[string]any {
+	var found []map[string]any
+	for _, l := range lines {
+		if l["msg"] == msg {
+			found = append(found, l)
+		}
+	}
+	return found
+}
+
+func rawAction(t *testing.T, a any) actions.RawAction {
+	b, err := json.Marshal(a)
+	assert.NoError(t, err)
+	ra, err := actions.NewRawAction(string(b))
+	assert.NoError(t, err)
+	return ra
+}
+
+func TestShardScopedLogging(t *testing.T) {
+	t.Run("logs and processor logger carry shard, pid and action", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		l := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		rp := &RecordProcessorFuncs{}
+		rp.ProcessRecordsFunc = func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+			rp.Logger().Info("handled batch")
+			return nil
+		}
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, rp, WithManagerLogger(l))
+
+		assert.NoError(t, manager.processRawAction(rawAction(t, actions.InitAction{Action: actions.INITITALIZE, ShardId: "shard-123"})))
+		assert.NoError(t, manager.processRawAction(rawAction(t, testProcessAction("1", "2", "3"))))
+
+		lines := logLines(t, buf)
+		handled := linesWithMsg(lines, "handled batch")
+		if assert.Len(t, handled, 1) {
+			assert.Equal(t, "shard-123", handled[0]["shard_id"])
+			assert.Equal(t, float64(os.Getpid()), handled[0]["worker_pid"])
+			assert.Equal(t, actions.PROCESS_RECORDS, handled[0]["action"])
+		}
+		batch := linesWithMsg(lines, "received batch")
+		if assert.Len(t, batch, 1) {
+			assert.Equal(t, "1", batch[0]["first_seq_num"])
+			assert.Equal(t, "3", batch[0]["last_seq_num"])
+			assert.Equal(t, float64(3), batch[0]["records"])
+		}
+
+		// between actions the logger is only scoped to the shard
+		manager.Logger().Info("idle")
+		idle := linesWithMsg(logLines(t, buf), "idle")
+		if assert.Len(t, idle, 1) {
+			assert.Equal(t, "shard-123", idle[0]["shard_id"])
+			assert.NotContains(t, idle[0], "action")
+		}
+	})
+
+	t.Run("samples per record logs", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		l := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		rp := &RecordProcessorFuncs{ProcessRecordsFunc: func([]actions.Record, int, *checkpoint.Checkpointer) error { return nil }}
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, rp, WithManagerLogger(l), WithRecordLogSampling(3))
+
+		assert.NoError(t, manager.processRawAction(rawAction(t, testProcessAction("1", "2", "3", "4"))))
+		assert.NoError(t, manager.processRawAction(rawAction(t, testProcessAction("5", "6", "7"))))
+
+		var seqNums []any
+		for _, l := range linesWithMsg(logLines(t, buf), "received record") {
+			seqNums = append(seqNums, l["seq_num"])
+		}
+		assert.Equal(t, []any{"1", "4", "7"}, seqNums)
+	})
+
+	t.Run("disables per record logs", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		l := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		rp := &RecordProcessorFuncs{ProcessRecordsFunc: func([]actions.Record, int, *checkpoint.Checkpointer) error { return nil }}
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, rp, WithManagerLogger(l), WithRecordLogSampling(0))
+
+		assert.NoError(t, manager.processRawAction(rawAction(t, testProcessAction("1", "2"))))
+		assert.Empty(t, linesWithMsg(logLines(t, buf), "received record"))
+	})
+}
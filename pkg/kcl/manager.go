@@ -1,44 +1,210 @@
 package kcl
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/wiretap"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Manager struct {
-	recordProcessor RecordProcessor
+	// recordProcessor is the processor as given to NewManager or
+	// NewManagerV2, and processor the same processor as called
+	recordProcessor any
+	processor       RecordProcessorV2
 	interfacer      *MultilangInterface
-	loggr           *slog.Logger
+	// baseLoggr is the logger given by the user, which shardLoggr and
+	// loggr are derived from
+	baseLoggr  *slog.Logger
+	shardLoggr *slog.Logger
+	// loggr is scoped to the action currently being handled
+	loggr          *slog.Logger
+	recordLogEvery int
+	recordsSeen    int
+	deadLetter     *DeadLetterPolicy
+	watchdog       *WatchdogPolicy
+	wireTap        *wiretap.Recorder
+	// exit terminates the process when the watchdog fires
+	exit       func(code int)
+	breakers   map[string]*CircuitBreaker
+	middleware []Middleware
+	// handler is the middleware chain ending in the RecordProcessor
+	handler       Handler
+	recoverPanics bool
+	// recoverPanicsSet records whether recoverPanics was chosen by the
+	// user, since Run and Start default it differently
+	recoverPanicsSet bool
+	// inputClosed is set when the input ended between actions, which
+	// Start treats as a clean shutdown
+	inputClosed bool
+	metrics     *managerMetrics
+	// muxes holds the handlers of every http server the manager serves,
+	// keyed by listen address
+	muxes         map[string]*http.ServeMux
+	tracer        trace.Tracer
+	recordCarrier RecordCarrierFunc
+	propagator    propagation.TextMapPropagator
+	// actionCtx carries the span of the action currently being handled
+	actionCtx context.Context
+
+	// mu guards state that is reported from other goroutines
+	mu sync.Mutex
+	// shardId is captured from the initialize action so it can be
+	// attached to anything the manager reports on behalf of the shard
+	shardId     string
+	servers     []*http.Server
+	serverAddrs []string
+	// health state, see Health
+	thresholds      HealthThresholds
+	phase           Phase
+	action          string
+	lastActionAt    time.Time
+	processingSince time.Time
+	lastCheckpoint  *CheckpointResult
 }
 
 type ManagerOpts func(kclm *Manager)
 
 func NewManager(i io.Reader, o io.Writer, rp RecordProcessor, opts ...ManagerOpts) *Manager {
+	return newManager(i, o, rp, AdaptRecordProcessor(rp), opts)
+}
+
+// NewManagerV2 creates a Manager for a RecordProcessorV2, which is
+// handed the Checkpointer as a checkpoint.Interface.
+func NewManagerV2(i io.Reader, o io.Writer, rp RecordProcessorV2, opts ...ManagerOpts) *Manager {
+	return newManager(i, o, rp, rp, opts)
+}
+
+func newManager(i io.Reader, o io.Writer, rp any, processor RecordProcessorV2, opts []ManagerOpts) *Manager {
 	kclm := &Manager{
 		recordProcessor: rp,
-		loggr:           slog.Default(),
+		processor:       processor,
+		baseLoggr:       slog.Default(),
+		recordLogEvery:  1,
+		exit:            os.Exit,
 	}
 	for _, opt := range opts {
 		opt(kclm)
 	}
+	kclm.setShardLogger("")
 	// set interffacer after apply opts since user could spec different logger
-	kclm.interfacer = NewMultilangInterface(i, o)
+	cpOpts := []checkpoint.CheckpointerOpts{
+		checkpoint.WithObserver(kclm.checkpointDone),
+		checkpoint.WithObserver(kclm.traceCheckpoint),
+	}
+	if kclm.metrics != nil {
+		cpOpts = append(cpOpts, checkpoint.WithObserver(func(o checkpoint.Observation) {
+			kclm.metrics.observeCheckpoint(kclm.shardId, o)
+		}))
+	}
+	kclm.interfacer = NewMultilangInterface(i, o,
+		WithCheckpointerOpts(cpOpts...),
+		WithWireTap(kclm.wireTap),
+		WithActionObserver(kclm.actionArrived),
+	)
+	kclm.handler = kclm.chain()
 	return kclm
 }
 
 func WithManagerLogger(l *slog.Logger) ManagerOpts {
 	return func(kclm *Manager) {
-		kclm.loggr = l
+		kclm.baseLoggr = l
+	}
+}
+
+// WithManagerWireTap records every message exchanged with the KCL
+// Multilang process to rec, see the wiretap package.
+func WithManagerWireTap(rec *wiretap.Recorder) ManagerOpts {
+	return func(kclm *Manager) {
+		kclm.wireTap = rec
+	}
+}
+
+// WithDeadLetterPolicy routes records that fail with a RecordError to
+// the policy's sink once they have been attempted MaxAttempts times,
+// then continues processing the rest of the batch. A MaxAttempts below
+// 1 is treated as 1.
+func WithDeadLetterPolicy(p DeadLetterPolicy) ManagerOpts {
+	return func(kclm *Manager) {
+		if p.MaxAttempts < 1 {
+			p.MaxAttempts = 1
+		}
+		kclm.deadLetter = &p
+	}
+}
+
+// WithPanicRecovery controls whether panics in RecordProcessor methods
+// are recovered and returned as a *PanicError. Recovery is off by
+// default for Run and on by default for Start. A panic is only tied to
+// a record, and so handled by the dead letter policy, when the batch
+// holds that one record. A panic in a batch of several records bypasses
+// the dead letter policy and fails the shard.
+func WithPanicRecovery(enabled bool) ManagerOpts {
+	return func(kclm *Manager) {
+		kclm.recoverPanics = enabled
+		kclm.recoverPanicsSet = true
+	}
+}
+
+// WithCircuitBreaker registers a CircuitBreaker used by the
+// RecordProcessor under name. Registered breakers are reported by
+// Manager.Health and released when the worker is asked to shut down.
+func WithCircuitBreaker(name string, cb *CircuitBreaker) ManagerOpts {
+	return func(kclm *Manager) {
+		if kclm.breakers == nil {
+			kclm.breakers = make(map[string]*CircuitBreaker)
+		}
+		kclm.breakers[name] = cb
+	}
+}
+
+// NotifyShutdown releases every registered CircuitBreaker so a
+// RecordProcessor blocked on an open breaker can return, checkpoint and
+// exit. Manager calls it as soon as KCL requests a shutdown, even while
+// the processor is still busy with a batch. It is safe to call from a
+// signal handler too.
+func (kclm *Manager) NotifyShutdown() {
+	for _, cb := range kclm.breakers {
+		cb.Shutdown()
+	}
+}
+
+// actionArrived is called as soon as an action is read, which may be
+// while the processor is still busy with the last one.
+func (kclm *Manager) actionArrived(actionType string) {
+	if actionType == actions.SHUTDOWN_REQUESTED {
+		kclm.NotifyShutdown()
 	}
 }
 
 // processRawAction calls different RecordProcessor methods
 // depending on what type of KCL Action the rawAction is.
-func (kclm *Manager) processRawAction(ra actions.RawAction) error {
-	kclm.loggr.Debug("processing kcl multilang raw action request", "action_type", ra.ActionType)
+func (kclm *Manager) processRawAction(ra actions.RawAction) (err error) {
+	kclm.actionStarted(ra.ActionType)
+	kclm.setActionLogger(ra.ActionType)
+	kclm.loggr.Debug("processing kcl multilang raw action request")
+	span := kclm.startActionSpan(ra)
+	// counted and traced once the action is handled so initialize is
+	// labelled with the shard it assigned
+	defer func() {
+		kclm.setActionLogger("")
+		kclm.actionDone(ra.ActionType, err)
+		kclm.metrics.observeAction(kclm.shardId, ra.ActionType)
+		span.SetAttributes(attribute.String("kcl.shard_id", kclm.shardId))
+		kclm.endActionSpan(span, err)
+	}()
 	// some of this "decoding" of the kcl raw action seems a bit pointless
 	// (namely for actions like leastLost) because some of the actions dont
 	// actually contain any additional information other than their action
@@ -49,8 +215,6 @@ func (kclm *Manager) processRawAction(ra actions.RawAction) error {
 	//     2. Depending on what *type* of action, unmarshal it into its
 	//        concrete type and call the relevent record processor method
 
-	// capture recordprossor method error for all cases
-	var err error
 	switch ra.ActionType {
 	case actions.INITITALIZE:
 		var a actions.InitAction
@@ -58,26 +222,39 @@ func (kclm *Manager) processRawAction(ra actions.RawAction) error {
 		if err != nil {
 			return err
 		}
-		err = kclm.recordProcessor.Initialize(a.ShardId, a.SeqNum, a.SubSeqNum)
+		kclm.mu.Lock()
+		kclm.shardId = a.ShardId
+		kclm.mu.Unlock()
+		kclm.setShardLogger(a.ShardId)
+		kclm.setActionLogger(ra.ActionType)
+		err = kclm.invoke(&Call{ActionType: ra.ActionType, Raw: ra, Init: a})
 	case actions.SHUTDOWN_REQUESTED:
 		// no need to unmarshal to concrete action type
 		// since the action contains nothing other than action name
-		err = kclm.recordProcessor.ShutdownRequested(kclm.interfacer.Checkpointer)
+		err = kclm.invoke(&Call{ActionType: ra.ActionType, Raw: ra, Checkpointer: kclm.interfacer.Checkpointer})
 	case actions.PROCESS_RECORDS:
 		var a actions.ProcessAction
 		a, err = ra.ToProcessAction()
 		if err != nil {
 			return err
 		}
-		err = kclm.recordProcessor.ProcessRecords(a.Records, a.MillisBehindLatest, kclm.interfacer.Checkpointer)
+		kclm.metrics.observeBatch(kclm.shardId, a)
+		span.SetAttributes(batchAttributes(a)...)
+		kclm.loggr.Debug("received batch", append(batchLogAttrs(a.Records), "lag_in_ms", a.MillisBehindLatest)...)
+		kclm.logRecords(a.Records)
+		recordSpans := kclm.startRecordSpans(a.Records)
+		start := time.Now()
+		err = kclm.processRecords(ra, a)
+		kclm.metrics.observeProcessRecords(kclm.shardId, time.Since(start))
+		endRecordSpans(recordSpans, a.Records, err)
 	case actions.LEASE_LOST:
 		// no need to unmarshal to concrete action type
 		// since the action contains nothing other than action name
-		err = kclm.recordProcessor.LeaseLost()
+		err = kclm.invoke(&Call{ActionType: ra.ActionType, Raw: ra})
 	case actions.SHARD_ENDED:
 		// no need to unmarshal to concrete action type
 		// since the action contains nothing other than action name
-		err = kclm.recordProcessor.ShardEnded(kclm.interfacer.Checkpointer)
+		err = kclm.invoke(&Call{ActionType: ra.ActionType, Raw: ra, Checkpointer: kclm.interfacer.Checkpointer})
 	default:
 		return fmt.Errorf("unsupported action type: %s", ra.ActionType)
 	}
@@ -88,26 +265,153 @@ func (kclm *Manager) processRawAction(ra actions.RawAction) error {
 	return nil
 }
 
+// invoke passes call through the middleware chain to the
+// RecordProcessor.
+func (kclm *Manager) invoke(call *Call) error {
+	call.ShardId = kclm.shardId
+	call.Logger = kclm.loggr
+	ctx, done := kclm.watch(call.ActionType)
+	defer done()
+	call.Context = ctx
+	return kclm.callProcessor(call.ActionType, call.Process.Records, func() error {
+		return kclm.handler(call)
+	})
+}
+
+// processRecords hands the batch to the RecordProcessor. When a dead
+// letter policy is configured and the processor fails with a
+// RecordError, the failing record is retried until it runs out of
+// attempts, sent to the dead letter sink, and the remainder of the batch
+// is handed back to the processor. The records after a dead letter are
+// only delivered once the sink accepted it, so the processor can never
+// checkpoint past a record that was neither processed nor dead lettered.
+func (kclm *Manager) processRecords(ra actions.RawAction, a actions.ProcessAction) error {
+	records := a.Records
+	var lastFailed *actions.Record
+	attempts := 0
+	for {
+		batch := a
+		batch.Records = records
+		err := kclm.invoke(&Call{
+			ActionType:   ra.ActionType,
+			Raw:          ra,
+			Process:      batch,
+			Checkpointer: kclm.interfacer.Checkpointer,
+		})
+		if err == nil || kclm.deadLetter == nil {
+			return err
+		}
+		var recErr *RecordError
+		if !errors.As(err, &recErr) {
+			return err
+		}
+		idx := recordIndex(records, recErr.Record)
+		if idx < 0 {
+			return fmt.Errorf("record error refers to a record not in the current batch: %w", err)
+		}
+
+		if lastFailed != nil && sameRecord(*lastFailed, recErr.Record) {
+			attempts++
+		} else {
+			lastFailed = &records[idx]
+			attempts = 1
+		}
+		if attempts < kclm.deadLetter.MaxAttempts {
+			kclm.loggr.Warn("retrying failed record", "seq_num", recErr.Record.SequenceNumber, "attempt", attempts, "error", recErr.Err)
+			records = records[idx:]
+			continue
+		}
+
+		dl := DeadLetter{
+			ShardId:  kclm.shardId,
+			Record:   records[idx],
+			Err:      recErr.Err,
+			Attempts: attempts,
+		}
+		err = kclm.deadLetter.Sink.Send(dl)
+		if err != nil {
+			return fmt.Errorf("error sending record <%s> to dead letter sink: %w", dl.Record.SequenceNumber, err)
+		}
+		kclm.loggr.Warn("sent record to dead letter sink", "seq_num", dl.Record.SequenceNumber, "attempts", attempts, "error", recErr.Err)
+
+		records = records[idx+1:]
+		lastFailed = nil
+		attempts = 0
+		if len(records) == 0 {
+			return nil
+		}
+	}
+}
+
+func recordIndex(records []actions.Record, r actions.Record) int {
+	for i := range records {
+		if sameRecord(records[i], r) {
+			return i
+		}
+	}
+	return -1
+}
+
+func sameRecord(a, b actions.Record) bool {
+	return a.SequenceNumber == b.SequenceNumber && a.SubSequenceNumber == b.SubSequenceNumber
+}
+
 // Run is the quickest way to start using this KCL Multilang interface
 // to consume kinesis records. It uses an instance of a MultilangInterfacer to
 // read Actions requested by the KCL Multilang process, then calls specific
 // methods on the provided RecordProcessor depending on which action was
 // requested. Finally it uses the interfacer again to write the completed
 // status message back to the KCL Multilang process.
+//
+// Run panics on any error. See Start for a version that returns errors.
 func (kclm *Manager) Run() {
+	err := kclm.run()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Start runs the same loop as Run but returns any error instead of
+// panicking, and recovers panics raised by the RecordProcessor (unless
+// disabled with WithPanicRecovery) so they are returned as a *PanicError
+// like any other processor error. Start returns nil once the KCL
+// Multilang process closes its end of the input between actions. Input
+// ending in the middle of an action, e.g. while the processor waits for
+// a checkpoint ack, leaves the action unanswered and is returned as an
+// error.
+func (kclm *Manager) Start() error {
+	if !kclm.recoverPanicsSet {
+		kclm.recoverPanics = true
+	}
+	err := kclm.run()
+	if kclm.inputClosed {
+		kclm.loggr.Info("kcl multilang input closed, shutting down")
+		return nil
+	}
+	return err
+}
+
+func (kclm *Manager) run() error {
+	err := kclm.startServers()
+	if err != nil {
+		return err
+	}
+	defer kclm.stopServers()
+
 	kclm.loggr.Info("starting up kcl interface, waiting for first instruction...")
 	for {
 		rawAction, err := kclm.interfacer.ReadActionRequest()
 		if err != nil {
-			panic(err)
+			kclm.inputClosed = errors.Is(err, io.EOF)
+			return err
 		}
 		err = kclm.processRawAction(rawAction)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		err = kclm.interfacer.WriteActionComplete(rawAction.ActionType)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		kclm.loggr.Debug("waiting for next kcl multilang input request")
 	}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"testing"
 
@@ -266,3 +268,142 @@ func TestProcessRawAction(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+// panicRecordProcessor panics in ProcessRecords and LeaseLost
+type panicRecordProcessor struct {
+	MockRecordProcessor
+}
+
+func (p *panicRecordProcessor) ProcessRecords(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+	var m map[string]int
+	m["boom"]++
+	return nil
+}
+
+func (p *panicRecordProcessor) LeaseLost() error {
+	panic("lease lost panic")
+}
+
+func TestPanicRecovery(t *testing.T) {
+	t.Run("converts process records panic to error with batch context", func(t *testing.T) {
+		logs := &bytes.Buffer{}
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, new(panicRecordProcessor), WithPanicRecovery(true),
+			WithManagerLogger(slog.New(slog.NewJSONHandler(logs, nil))))
+		manager.shardId = "shard-123"
+
+		actionBytes, _ := json.Marshal(testProcessAction("seq-1", "seq-2", "seq-3"))
+		rAction, err := actions.NewRawAction(string(actionBytes))
+		assert.NoError(t, err)
+
+		err = manager.processRawAction(rAction)
+		var pErr *PanicError
+		if assert.ErrorAs(t, err, &pErr) {
+			assert.Equal(t, actions.PROCESS_RECORDS, pErr.ActionType)
+			assert.Equal(t, "shard-123", pErr.ShardId)
+			assert.Equal(t, "seq-1", pErr.FirstSeqNum)
+			assert.Equal(t, "seq-3", pErr.LastSeqNum)
+			assert.Contains(t, string(pErr.Stack), "panicRecordProcessor")
+			// runtime errors are errors, so they can be unwrapped
+			assert.NotNil(t, errors.Unwrap(pErr))
+			assert.Equal(t, "record processor panicked handling processRecords action for shard <shard-123> (records <seq-1> to <seq-3>): "+pErr.Value.(error).Error(), pErr.Error())
+		}
+		// the stack is logged on its own, not as part of the error
+		var entry struct {
+			Error string `json:"error"`
+			Stack string `json:"stack"`
+		}
+		assert.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+		assert.Equal(t, err.Error(), entry.Error)
+		assert.Contains(t, entry.Stack, "panicRecordProcessor")
+	})
+
+	t.Run("converts lease lost panic to error", func(t *testing.T) {
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, new(panicRecordProcessor), WithPanicRecovery(true))
+
+		rAction, err := actions.NewRawAction(`{"action":"leaseLost"}`)
+		assert.NoError(t, err)
+
+		err = manager.processRawAction(rAction)
+		var pErr *PanicError
+		if assert.ErrorAs(t, err, &pErr) {
+			assert.Equal(t, actions.LEASE_LOST, pErr.ActionType)
+			assert.Equal(t, "lease lost panic", pErr.Value)
+			assert.Empty(t, pErr.FirstSeqNum)
+		}
+	})
+
+	t.Run("ties panic in single record batch to record", func(t *testing.T) {
+		sink := &recordingSink{}
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, new(panicRecordProcessor), WithPanicRecovery(true),
+			WithDeadLetterPolicy(DeadLetterPolicy{Sink: sink, MaxAttempts: 2}), WithManagerLogger(quietLogger))
+
+		err := manager.processRecords(actions.RawAction{ActionType: actions.PROCESS_RECORDS}, testProcessAction("seq-1"))
+		assert.NoError(t, err)
+		if assert.Len(t, sink.sent, 1) {
+			assert.Equal(t, "seq-1", sink.sent[0].Record.SequenceNumber)
+			assert.Equal(t, 2, sink.sent[0].Attempts)
+			var pErr *PanicError
+			assert.ErrorAs(t, sink.sent[0].Err, &pErr)
+		}
+
+		// which record of a larger batch panicked is not known
+		err = manager.processRecords(actions.RawAction{ActionType: actions.PROCESS_RECORDS}, testProcessAction("seq-2", "seq-3"))
+		var recErr *RecordError
+		assert.False(t, errors.As(err, &recErr))
+		var pErr *PanicError
+		assert.ErrorAs(t, err, &pErr)
+		assert.Len(t, sink.sent, 1)
+	})
+
+	t.Run("does not recover by default", func(t *testing.T) {
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, new(panicRecordProcessor))
+
+		rAction, err := actions.NewRawAction(`{"action":"leaseLost"}`)
+		assert.NoError(t, err)
+
+		assert.Panics(t, func() { manager.processRawAction(rAction) })
+	})
+}
+
+func TestStart(t *testing.T) {
+	t.Run("returns nil when input is closed", func(t *testing.T) {
+		mockReader := bytes.NewBufferString(`{"action":"initialize","shardId":"shard-123","sequenceNumber":"seq-456","subSequenceNumber":0}`)
+		mockWriter := &bytes.Buffer{}
+		mockProcessor := new(MockRecordProcessor)
+
+		manager := NewManager(mockReader, mockWriter, mockProcessor)
+
+		err := manager.Start()
+		assert.NoError(t, err)
+		assert.True(t, mockProcessor.InitializeCalled)
+		assert.JSONEq(t, `{"action":"status","responseFor":"initialize"}`, mockWriter.String())
+	})
+
+	t.Run("recovers panics by default", func(t *testing.T) {
+		mockReader := bytes.NewBufferString(`{"action":"leaseLost"}`)
+		manager := NewManager(mockReader, &bytes.Buffer{}, new(panicRecordProcessor))
+
+		var pErr *PanicError
+		assert.ErrorAs(t, manager.Start(), &pErr)
+	})
+
+	t.Run("returns processor errors", func(t *testing.T) {
+		mockReader := bytes.NewBufferString(`{"action":"leaseLost"}`)
+		mockProcessor := new(MockRecordProcessor)
+		mockProcessor.LeaseLostError = errors.New("processor error")
+
+		manager := NewManager(mockReader, &bytes.Buffer{}, mockProcessor)
+
+		assert.EqualError(t, manager.Start(), "processor error")
+	})
+
+	t.Run("returns processor errors wrapping eof", func(t *testing.T) {
+		mockReader := bytes.NewBufferString(`{"action":"leaseLost"}`)
+		mockProcessor := new(MockRecordProcessor)
+		mockProcessor.LeaseLostError = fmt.Errorf("reading config: %w", io.EOF)
+
+		manager := NewManager(mockReader, &bytes.Buffer{}, mockProcessor)
+
+		assert.ErrorIs(t, manager.Start(), io.EOF)
+	})
+}
@@ -0,0 +1,189 @@
+package kcl
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// managerMetrics holds the prometheus collectors the Manager updates.
+// Its methods are safe to call on a nil *managerMetrics so the manager
+// does not need to check whether metrics are enabled.
+type managerMetrics struct {
+	registry *prometheus.Registry
+
+	actions            *prometheus.CounterVec
+	records            *prometheus.CounterVec
+	bytes              *prometheus.CounterVec
+	millisBehind       *prometheus.GaugeVec
+	arrivalAge         *prometheus.HistogramVec
+	processDuration    *prometheus.HistogramVec
+	checkpointDuration *prometheus.HistogramVec
+	checkpointErrors   *prometheus.CounterVec
+	watchdogStalls     *prometheus.CounterVec
+}
+
+func newManagerMetrics() *managerMetrics {
+	shard := []string{"shard_id"}
+	m := &managerMetrics{
+		registry: prometheus.NewRegistry(),
+		actions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kcl_actions_received_total",
+			Help: "KCL Multilang actions received, by action type.",
+		}, []string{"shard_id", "action"}),
+		records: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kcl_records_received_total",
+			Help: "Records received in processRecords actions, whether or not the record processor handled them.",
+		}, shard),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kcl_record_bytes_received_total",
+			Help: "Decoded bytes of record data received in processRecords actions.",
+		}, shard),
+		millisBehind: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kcl_millis_behind_latest",
+			Help: "MillisBehindLatest reported with the latest batch of records.",
+		}, shard),
+		arrivalAge: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kcl_record_arrival_age_seconds",
+			Help:    "Time between a record arriving in the stream and it being handed to the record processor.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 16),
+		}, shard),
+		processDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kcl_process_records_duration_seconds",
+			Help:    "Time spent processing a processRecords action.",
+			Buckets: prometheus.DefBuckets,
+		}, shard),
+		checkpointDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kcl_checkpoint_duration_seconds",
+			Help:    "Round trip time of checkpoints sent to the KCL Multilang process.",
+			Buckets: prometheus.DefBuckets,
+		}, shard),
+		checkpointErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kcl_checkpoint_errors_total",
+			Help: "Failed checkpoints, by kind of error: throttling, shutdown, invalid_state, dependency or other_kcl for errors KCL responded with, invalid_ack for acks that could not be read, io if the round trip itself failed.",
+		}, []string{"shard_id", "error"}),
+		watchdogStalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kcl_watchdog_stalls_total",
+			Help: "Record processor calls that ran past the watchdog deadline, by action type.",
+		}, []string{"shard_id", "action"}),
+	}
+	m.registry.MustRegister(
+		m.actions, m.records, m.bytes, m.millisBehind, m.arrivalAge,
+		m.processDuration, m.checkpointDuration, m.checkpointErrors, m.watchdogStalls,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// WithMetrics serves prometheus metrics about the manager under /metrics
+// on addr (e.g. ":9102"). Since a host usually runs many KCL child
+// processes, addr may use port 0 to pick a free port, which is logged on
+// start up and reported by ServerAddrs.
+func WithMetrics(addr string) ManagerOpts {
+	return func(kclm *Manager) {
+		if kclm.metrics == nil {
+			kclm.metrics = newManagerMetrics()
+		}
+		kclm.handle(addr, "/metrics", kclm.MetricsHandler())
+	}
+}
+
+// MetricsHandler returns an http.Handler serving the manager's
+// prometheus metrics, for mounting on a server of your own. It returns
+// nil unless the manager was created with WithMetrics.
+func (kclm *Manager) MetricsHandler() http.Handler {
+	if kclm.metrics == nil {
+		return nil
+	}
+	return promhttp.HandlerFor(kclm.metrics.registry, promhttp.HandlerOpts{})
+}
+
+func (m *managerMetrics) observeAction(shardId, actionType string) {
+	if m == nil {
+		return
+	}
+	m.actions.WithLabelValues(shardId, actionType).Inc()
+}
+
+func (m *managerMetrics) observeBatch(shardId string, a actions.ProcessAction) {
+	if m == nil {
+		return
+	}
+	m.millisBehind.WithLabelValues(shardId).Set(float64(a.MillisBehindLatest))
+	m.records.WithLabelValues(shardId).Add(float64(len(a.Records)))
+	now := time.Now()
+	var size int
+	for _, r := range a.Records {
+		size += decodedLen(r.Data)
+		if r.ApproximateArrivalTimestamp > 0 {
+			arrived := time.UnixMilli(int64(r.ApproximateArrivalTimestamp))
+			m.arrivalAge.WithLabelValues(shardId).Observe(now.Sub(arrived).Seconds())
+		}
+	}
+	m.bytes.WithLabelValues(shardId).Add(float64(size))
+}
+
+func (m *managerMetrics) observeProcessRecords(shardId string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.processDuration.WithLabelValues(shardId).Observe(d.Seconds())
+}
+
+func (m *managerMetrics) observeCheckpoint(shardId string, o checkpoint.Observation) {
+	if m == nil {
+		return
+	}
+	m.checkpointDuration.WithLabelValues(shardId).Observe(o.Duration.Seconds())
+	if o.Err != nil {
+		m.checkpointErrors.WithLabelValues(shardId, checkpointErrorKind(o.Err)).Inc()
+	}
+}
+
+// checkpointErrorKind maps a failed checkpoint to one of a fixed set of
+// label values, so an error message KCL sends cannot add series without
+// bound.
+func checkpointErrorKind(err error) string {
+	var ackErr *checkpoint.AckError
+	if errors.As(err, &ackErr) {
+		// KCL may send the exception's class with its package
+		switch ackErr.Err[strings.LastIndex(ackErr.Err, ".")+1:] {
+		case "ThrottlingException":
+			return "throttling"
+		case "ShutdownException":
+			return "shutdown"
+		case "InvalidStateException":
+			return "invalid_state"
+		case "KinesisClientLibDependencyException":
+			return "dependency"
+		}
+		return "other_kcl"
+	}
+	var invalidErr *checkpoint.InvalidAckError
+	if errors.As(err, &invalidErr) {
+		return "invalid_ack"
+	}
+	return "io"
+}
+
+func (m *managerMetrics) observeStall(shardId, actionType string) {
+	if m == nil {
+		return
+	}
+	m.watchdogStalls.WithLabelValues(shardId, actionType).Inc()
+}
+
+// decodedLen returns the length of base64 encoded data once decoded
+// without having to decode it.
+func decodedLen(data string) int {
+	n := len(data) / 4 * 3
+	return n - strings.Count(data[max(len(data)-2, 0):], "=")
+}
@@ -0,0 +1,111 @@
+package kcl
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrapeMetrics(t *testing.T, h http.Handler) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	t.Run("records action, batch and checkpoint metrics", func(t *testing.T) {
+		rp := &RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				return cp.CheckpointBatch()
+			},
+		}
+		mockReader := bytes.NewBufferString(`{"action":"checkpoint","error":"ThrottlingException"}`)
+		manager := NewManager(mockReader, &bytes.Buffer{}, rp, WithMetrics("127.0.0.1:0"))
+
+		rAction, err := actions.NewRawAction(`{"action":"initialize","shardId":"shard-123"}`)
+		assert.NoError(t, err)
+		assert.NoError(t, manager.processRawAction(rAction))
+
+		batch := testProcessAction("1", "2")
+		batch.MillisBehindLatest = 250
+		batch.Records[0].ApproximateArrivalTimestamp = int(time.Now().Add(-time.Second).UnixMilli())
+		actionBytes, _ := json.Marshal(batch)
+		rAction, err = actions.NewRawAction(string(actionBytes))
+		assert.NoError(t, err)
+		var ackErr *checkpoint.AckError
+		assert.ErrorAs(t, manager.processRawAction(rAction), &ackErr)
+
+		body := scrapeMetrics(t, manager.MetricsHandler())
+		assert.Contains(t, body, `kcl_actions_received_total{action="initialize",shard_id="shard-123"} 1`)
+		assert.Contains(t, body, `kcl_actions_received_total{action="processRecords",shard_id="shard-123"} 1`)
+		assert.Contains(t, body, `kcl_records_received_total{shard_id="shard-123"} 2`)
+		// "ZGF0YQ==" decodes to 4 bytes
+		assert.Contains(t, body, `kcl_record_bytes_received_total{shard_id="shard-123"} 8`)
+		assert.Contains(t, body, `kcl_millis_behind_latest{shard_id="shard-123"} 250`)
+		assert.Contains(t, body, `kcl_record_arrival_age_seconds_count{shard_id="shard-123"} 1`)
+		assert.Contains(t, body, `kcl_process_records_duration_seconds_count{shard_id="shard-123"} 1`)
+		assert.Contains(t, body, `kcl_checkpoint_duration_seconds_count{shard_id="shard-123"} 1`)
+		assert.Contains(t, body, `kcl_checkpoint_errors_total{error="throttling",shard_id="shard-123"} 1`)
+	})
+
+	t.Run("serves metrics while running", func(t *testing.T) {
+		inR, inW := io.Pipe()
+		manager := NewManager(inR, io.Discard, new(MockRecordProcessor), WithMetrics("127.0.0.1:0"))
+
+		done := make(chan error)
+		go func() {
+			done <- manager.Start()
+		}()
+		assert.Eventually(t, func() bool { return len(manager.ServerAddrs()) == 1 }, time.Second, time.Millisecond)
+
+		resp, err := http.Get("http://" + manager.ServerAddrs()[0] + "/metrics")
+		if assert.NoError(t, err) {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.True(t, strings.Contains(string(body), "go_goroutines"))
+		}
+
+		inW.Close()
+		assert.NoError(t, <-done)
+		assert.Empty(t, manager.ServerAddrs())
+	})
+
+	t.Run("metrics handler is nil when disabled", func(t *testing.T) {
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, new(MockRecordProcessor))
+		assert.Nil(t, manager.MetricsHandler())
+	})
+}
+
+func TestDecodedLen(t *testing.T) {
+	for _, s := range []string{"", "a", "ab", "abc", "abcd", "hello world"} {
+		encoded := base64.StdEncoding.EncodeToString([]byte(s))
+		assert.Equal(t, len(s), decodedLen(encoded), encoded)
+	}
+}
+
+func TestCheckpointErrorKind(t *testing.T) {
+	for err, want := range map[error]string{
+		&checkpoint.AckError{Err: "ThrottlingException"}:                                       "throttling",
+		&checkpoint.AckError{Err: "software.amazon.kinesis.exceptions.ShutdownException"}:      "shutdown",
+		&checkpoint.AckError{Err: "InvalidStateException"}:                                     "invalid_state",
+		&checkpoint.AckError{Err: "KinesisClientLibDependencyException"}:                       "dependency",
+		&checkpoint.AckError{Err: "lease table unavailable: request id 8f2c"}:                  "other_kcl",
+		fmt.Errorf("checkpointing: %w", &checkpoint.InvalidAckError{Err: io.ErrUnexpectedEOF}): "invalid_ack",
+		io.ErrUnexpectedEOF: "io",
+	} {
+		assert.Equal(t, want, checkpointErrorKind(err), err.Error())
+	}
+}
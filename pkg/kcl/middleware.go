@@ -0,0 +1,128 @@
+package kcl
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+)
+
+// Call describes a single RecordProcessor lifecycle call as it passes
+// through the Manager's middleware chain.
+type Call struct {
+	// ActionType is the KCL action that triggered the call and decides
+	// which RecordProcessor method is called at the end of the chain.
+	ActionType string
+	// ShardId is the shard the manager was initialized with. It is empty
+	// until the initialize action has been received.
+	ShardId string
+	// Raw is the action as it was read from the KCL Multilang process
+	Raw actions.RawAction
+	// Init is set for initialize calls
+	Init actions.InitAction
+	// Process is set for processRecords calls. A middleware may change
+	// Process.Records before calling next to filter the batch handed to
+	// the RecordProcessor.
+	Process actions.ProcessAction
+	// Checkpointer is the checkpointer handed to the RecordProcessor.
+	// It is nil for initialize and leaseLost calls since the processor
+	// is not given one for those either. A middleware may replace it,
+	// e.g. to add retries to every checkpoint.
+	Checkpointer checkpoint.Interface
+	// Logger carries the shard ID, worker PID and action type. It is
+	// handed to RecordProcessors implementing LoggerSetter.
+	Logger *slog.Logger
+	// Context is cancelled once the call returns, or with ErrStalled as
+	// its cause when it runs past the watchdog deadline. It is handed to
+	// RecordProcessors implementing ContextSetter.
+	Context context.Context
+}
+
+// Handler handles a single RecordProcessor lifecycle call.
+type Handler func(call *Call) error
+
+// Middleware wraps a Handler to run code around (or instead of) every
+// RecordProcessor lifecycle call.
+type Middleware func(next Handler) Handler
+
+// WithMiddleware adds middleware around every RecordProcessor call. The
+// first middleware given is the outermost one. Calling WithMiddleware
+// more than once appends to the chain.
+func WithMiddleware(mws ...Middleware) ManagerOpts {
+	return func(kclm *Manager) {
+		kclm.middleware = append(kclm.middleware, mws...)
+	}
+}
+
+// chain composes the manager's middleware around the RecordProcessor.
+func (kclm *Manager) chain() Handler {
+	h := kclm.dispatch
+	for i := len(kclm.middleware) - 1; i >= 0; i-- {
+		h = kclm.middleware[i](h)
+	}
+	return h
+}
+
+// dispatch is the end of the middleware chain, calling the
+// RecordProcessor method matching the call's action type.
+func (kclm *Manager) dispatch(call *Call) error {
+	if ls, ok := kclm.processor.(LoggerSetter); ok && call.Logger != nil {
+		ls.SetLogger(call.Logger)
+	}
+	if cs, ok := kclm.processor.(ContextSetter); ok && call.Context != nil {
+		cs.SetContext(call.Context)
+	}
+	switch call.ActionType {
+	case actions.INITITALIZE:
+		return kclm.processor.Initialize(call.Init.ShardId, call.Init.SeqNum, call.Init.SubSeqNum)
+	case actions.PROCESS_RECORDS:
+		return kclm.processor.ProcessRecords(call.Process.Records, call.Process.MillisBehindLatest, call.Checkpointer)
+	case actions.LEASE_LOST:
+		return kclm.processor.LeaseLost()
+	case actions.SHARD_ENDED:
+		return kclm.processor.ShardEnded(call.Checkpointer)
+	case actions.SHUTDOWN_REQUESTED:
+		return kclm.processor.ShutdownRequested(call.Checkpointer)
+	default:
+		return fmt.Errorf("unsupported action type: %s", call.ActionType)
+	}
+}
+
+// LoggingMiddleware logs every RecordProcessor call at debug level, and
+// any error returned from it at error level.
+func LoggingMiddleware(l *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(call *Call) error {
+			attrs := []any{"action_type", call.ActionType, "shard_id", call.ShardId}
+			if call.ActionType == actions.PROCESS_RECORDS {
+				attrs = append(attrs, batchLogAttrs(call.Process.Records)...)
+				attrs = append(attrs, "lag_in_ms", call.Process.MillisBehindLatest)
+			}
+			l.Debug("calling record processor", attrs...)
+			err := next(call)
+			if err != nil {
+				l.Error("record processor returned error", append(attrs, "error", err)...)
+				return err
+			}
+			l.Debug("record processor call complete", attrs...)
+			return nil
+		}
+	}
+}
+
+// TimingMiddleware measures how long every RecordProcessor call takes
+// (including any middleware after it in the chain) and reports it to
+// observe along with the call and its result.
+func TimingMiddleware(observe func(call *Call, d time.Duration, err error)) Middleware {
+	return func(next Handler) Handler {
+		return func(call *Call) error {
+			start := time.Now()
+			err := next(call)
+			observe(call, time.Since(start), err)
+			return err
+		}
+	}
+}
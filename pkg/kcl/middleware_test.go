@@ -0,0 +1,120 @@
+package kcl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	t.Run("composes middleware in order", func(t *testing.T) {
+		var order []string
+		tag := func(name string) Middleware {
+			return func(next Handler) Handler {
+				return func(call *Call) error {
+					order = append(order, name+":before")
+					err := next(call)
+					order = append(order, name+":after")
+					return err
+				}
+			}
+		}
+		mockProcessor := new(MockRecordProcessor)
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, mockProcessor,
+			WithMiddleware(tag("first"), tag("second")),
+			WithMiddleware(tag("third")),
+		)
+
+		rAction, err := actions.NewRawAction(`{"action":"leaseLost"}`)
+		assert.NoError(t, err)
+
+		assert.NoError(t, manager.processRawAction(rAction))
+		assert.True(t, mockProcessor.LeaseLostCalled)
+		assert.Equal(t, []string{
+			"first:before", "second:before", "third:before",
+			"third:after", "second:after", "first:after",
+		}, order)
+	})
+
+	t.Run("exposes action and checkpointer", func(t *testing.T) {
+		var got *Call
+		capture := func(next Handler) Handler {
+			return func(call *Call) error {
+				got = call
+				return next(call)
+			}
+		}
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, new(MockRecordProcessor), WithMiddleware(capture))
+		manager.shardId = "shard-123"
+
+		actionBytes, _ := json.Marshal(testProcessAction("1", "2"))
+		rAction, err := actions.NewRawAction(string(actionBytes))
+		assert.NoError(t, err)
+
+		assert.NoError(t, manager.processRawAction(rAction))
+		if assert.NotNil(t, got) {
+			assert.Equal(t, actions.PROCESS_RECORDS, got.ActionType)
+			assert.Equal(t, "shard-123", got.ShardId)
+			assert.Len(t, got.Process.Records, 2)
+			assert.Equal(t, manager.interfacer.Checkpointer, got.Checkpointer)
+		}
+	})
+
+	t.Run("can filter records", func(t *testing.T) {
+		dropFirst := func(next Handler) Handler {
+			return func(call *Call) error {
+				call.Process.Records = call.Process.Records[1:]
+				return next(call)
+			}
+		}
+		mockProcessor := new(MockRecordProcessor)
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, mockProcessor, WithMiddleware(dropFirst))
+
+		actionBytes, _ := json.Marshal(testProcessAction("1", "2"))
+		rAction, err := actions.NewRawAction(string(actionBytes))
+		assert.NoError(t, err)
+
+		assert.NoError(t, manager.processRawAction(rAction))
+		if assert.Len(t, mockProcessor.ProcessRecordsArgs.Records, 1) {
+			assert.Equal(t, "2", mockProcessor.ProcessRecordsArgs.Records[0].SequenceNumber)
+		}
+	})
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	mockProcessor := new(MockRecordProcessor)
+	mockProcessor.ShardEndedError = errors.New("processor error")
+	manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, mockProcessor, WithMiddleware(LoggingMiddleware(logger)))
+
+	rAction, err := actions.NewRawAction(`{"action":"shardEnded"}`)
+	assert.NoError(t, err)
+
+	assert.Error(t, manager.processRawAction(rAction))
+	assert.Contains(t, logs.String(), `"msg":"calling record processor"`)
+	assert.Contains(t, logs.String(), `"msg":"record processor returned error"`)
+	assert.Contains(t, logs.String(), `"error":"processor error"`)
+}
+
+func TestTimingMiddleware(t *testing.T) {
+	var observed []string
+	timing := TimingMiddleware(func(call *Call, d time.Duration, err error) {
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		observed = append(observed, call.ActionType)
+	})
+	manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, new(MockRecordProcessor), WithMiddleware(timing))
+
+	for _, msg := range []string{`{"action":"initialize","shardId":"shard-1"}`, `{"action":"leaseLost"}`} {
+		rAction, err := actions.NewRawAction(msg)
+		assert.NoError(t, err)
+		assert.NoError(t, manager.processRawAction(rAction))
+	}
+	assert.Equal(t, []string{actions.INITITALIZE, actions.LEASE_LOST}, observed)
+}
@@ -0,0 +1,74 @@
+package kcl
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+)
+
+// PanicError is returned in place of a panic recovered from a
+// RecordProcessor method. It carries enough context to find the shard
+// and batch that caused it. The stack trace is left out of Error so the
+// error stays one line wherever it is logged or wrapped, log Stack as
+// its own attribute instead. Manager does when it recovers a panic.
+type PanicError struct {
+	// Value is the value the RecordProcessor panicked with
+	Value      any
+	ActionType string
+	ShardId    string
+	// FirstSeqNum and LastSeqNum are the sequence numbers of the first
+	// and last record in the batch being processed. They are empty for
+	// actions that do not carry records.
+	FirstSeqNum string
+	LastSeqNum  string
+	// Stack is the stack trace of the goroutine that panicked
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	msg := fmt.Sprintf("record processor panicked handling %s action for shard <%s>", e.ActionType, e.ShardId)
+	if e.FirstSeqNum != "" {
+		msg += fmt.Sprintf(" (records <%s> to <%s>)", e.FirstSeqNum, e.LastSeqNum)
+	}
+	return fmt.Sprintf("%s: %v", msg, e.Value)
+}
+
+// Unwrap exposes the panic value if the processor panicked with an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// callProcessor runs fn, a call into the RecordProcessor for actionType
+// with the given batch of records. When panic recovery is enabled a
+// panic in fn is returned as a *PanicError instead, wrapped in a
+// RecordError if the batch holds a single record, which must be the one
+// that caused it.
+func (kclm *Manager) callProcessor(actionType string, records []actions.Record, fn func() error) (err error) {
+	if !kclm.recoverPanics {
+		return fn()
+	}
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		pErr := &PanicError{
+			Value:      v,
+			ActionType: actionType,
+			ShardId:    kclm.shardId,
+			Stack:      debug.Stack(),
+		}
+		if len(records) > 0 {
+			pErr.FirstSeqNum = records[0].SequenceNumber
+			pErr.LastSeqNum = records[len(records)-1].SequenceNumber
+		}
+		kclm.loggr.Error("recovered record processor panic", "error", pErr, "stack", string(pErr.Stack))
+		err = pErr
+		if len(records) == 1 {
+			err = NewRecordError(records[0], pErr)
+		}
+	}()
+	return fn()
+}
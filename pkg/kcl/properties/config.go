@@ -0,0 +1,390 @@
+package properties
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Config holds the MultiLangDaemon settings of a properties file. Unset
+// optional settings are nil (or empty strings), so the KCL's defaults
+// apply to them.
+type Config struct {
+	// ExecutableName is the record processor command line the daemon
+	// starts for every shard
+	ExecutableName string `properties:"executableName"`
+	StreamName     string `properties:"streamName"`
+	// StreamArn can be set instead of StreamName
+	StreamArn       string `properties:"streamArn"`
+	ApplicationName string `properties:"applicationName"`
+	// InitialPositionInStream is where shards without a checkpoint start,
+	// TRIM_HORIZON, LATEST or AT_TIMESTAMP
+	InitialPositionInStream string `properties:"initialPositionInStream"`
+	// InitialPositionInStreamExtended is the timestamp, in seconds since
+	// the epoch, shards start at with AT_TIMESTAMP
+	InitialPositionInStreamExtended *int   `properties:"initialPositionInStreamExtended"`
+	RegionName                      string `properties:"regionName"`
+	KinesisEndpoint                 string `properties:"kinesisEndpoint"`
+	DynamoDBEndpoint                string `properties:"dynamoDBEndpoint"`
+	AWSCredentialsProvider          string `properties:"AWSCredentialsProvider"`
+	ProcessingLanguage              string `properties:"processingLanguage"`
+	WorkerId                        string `properties:"workerId"`
+
+	// lease settings
+	FailoverTimeMillis               *int  `properties:"failoverTimeMillis"`
+	MaxLeasesForWorker               *int  `properties:"maxLeasesForWorker"`
+	MaxLeasesToStealAtOneTime        *int  `properties:"maxLeasesToStealAtOneTime"`
+	CleanupLeasesUponShardCompletion *bool `properties:"cleanupLeasesUponShardCompletion"`
+	InitialLeaseTableReadCapacity    *int  `properties:"initialLeaseTableReadCapacity"`
+	InitialLeaseTableWriteCapacity   *int  `properties:"initialLeaseTableWriteCapacity"`
+	ShardSyncIntervalMillis          *int  `properties:"shardSyncIntervalMillis"`
+
+	// retrieval settings
+	// RetrievalMode is FANOUT (the default) or POLLING
+	RetrievalMode                            string `properties:"retrievalMode"`
+	MaxRecords                               *int   `properties:"maxRecords"`
+	IdleTimeBetweenReadsInMillis             *int   `properties:"idleTimeBetweenReadsInMillis"`
+	CallProcessRecordsEvenForEmptyRecordList *bool  `properties:"callProcessRecordsEvenForEmptyRecordList"`
+	ParentShardPollIntervalMillis            *int   `properties:"parentShardPollIntervalMillis"`
+	TaskBackoffTimeMillis                    *int   `properties:"taskBackoffTimeMillis"`
+
+	// metrics settings
+	// MetricsLevel is NONE, SUMMARY or DETAILED
+	MetricsLevel            string `properties:"metricsLevel"`
+	MetricsBufferTimeMillis *int   `properties:"metricsBufferTimeMillis"`
+	MetricsMaxQueueSize     *int   `properties:"metricsMaxQueueSize"`
+
+	// Extra holds the settings Config has no field for. They are passed
+	// on to the KCL as they are.
+	Extra map[string]string
+
+	// lines maps keys to the line they were set on, for Issues
+	lines map[string]int
+}
+
+// Severity tells whether an Issue makes the KCL fail or is only
+// suspicious.
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	if s == Warning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Issue is a problem found in a properties file. Line is 0 for a
+// missing setting, or for a Config that was not read from a file.
+type Issue struct {
+	Line     int
+	Key      string
+	Severity Severity
+	Msg      string
+}
+
+func (i Issue) String() string {
+	var sb strings.Builder
+	if i.Line > 0 {
+		fmt.Fprintf(&sb, "line %d: ", i.Line)
+	}
+	if i.Severity == Warning {
+		sb.WriteString("warning: ")
+	}
+	if i.Key != "" {
+		fmt.Fprintf(&sb, "%s: ", i.Key)
+	}
+	sb.WriteString(i.Msg)
+	return sb.String()
+}
+
+// ValidationError is returned for a configuration with errors, one
+// Issue per error.
+type ValidationError struct {
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		msgs[i] = issue.String()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// LoadConfig reads and validates the properties file at path.
+func LoadConfig(path string) (*Config, error) {
+	p, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.Decode()
+	if err != nil {
+		return c, fmt.Errorf("%s:\n%w", path, err)
+	}
+	return c, nil
+}
+
+// Decode returns the Config of p, and a *ValidationError if it is not
+// valid. Warnings, see Lint, are not returned.
+func (p *Properties) Decode() (*Config, error) {
+	c, issues := Lint(p)
+	var errs []Issue
+	for _, issue := range issues {
+		if issue.Severity == Error {
+			errs = append(errs, issue)
+		}
+	}
+	if len(errs) > 0 {
+		return c, &ValidationError{Issues: errs}
+	}
+	return c, nil
+}
+
+// Lint decodes p and returns everything wrong with it, in line order:
+// values that do not parse or are out of range, settings that do not
+// go together, and as warnings unknown keys (likely typos) and settings
+// that are allowed but likely mistakes.
+func Lint(p *Properties) (*Config, []Issue) {
+	c := &Config{lines: map[string]int{}}
+	var issues []Issue
+	fields := configFields()
+	for _, e := range p.Entries {
+		c.lines[e.Key] = e.Line
+		idx, ok := fields[e.Key]
+		if !ok {
+			if c.Extra == nil {
+				c.Extra = map[string]string{}
+			}
+			c.Extra[e.Key] = e.Value
+			if slices.Contains(passThrough, e.Key) || strings.Contains(e.Key, ".") {
+				continue
+			}
+			msg := "unknown setting"
+			if s := suggest(e.Key, fields); s != "" {
+				msg = fmt.Sprintf("unknown setting, did you mean %s?", s)
+			}
+			issues = append(issues, Issue{Line: e.Line, Key: e.Key, Severity: Warning, Msg: msg})
+			continue
+		}
+		err := setField(reflect.ValueOf(c).Elem().Field(idx), e.Value)
+		if err != nil {
+			issues = append(issues, Issue{Line: e.Line, Key: e.Key, Msg: err.Error()})
+		}
+	}
+	issues = append(issues, c.check()...)
+	slices.SortStableFunc(issues, func(a, b Issue) int { return a.Line - b.Line })
+	return c, issues
+}
+
+// Validate checks the values of c and the rules between them. It
+// returns a *ValidationError listing every error.
+func (c *Config) Validate() error {
+	var errs []Issue
+	for _, issue := range c.check() {
+		if issue.Severity == Error {
+			errs = append(errs, issue)
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Issues: errs}
+	}
+	return nil
+}
+
+// Line returns the line key was set on, or 0.
+func (c *Config) Line(key string) int {
+	return c.lines[key]
+}
+
+// check returns the issues with the values of c.
+func (c *Config) check() []Issue {
+	var issues []Issue
+	add := func(sev Severity, key, format string, args ...any) {
+		issues = append(issues, Issue{Line: c.lines[key], Key: key, Severity: sev, Msg: fmt.Sprintf(format, args...)})
+	}
+	required := func(key, value string) {
+		if strings.TrimSpace(value) == "" {
+			add(Error, key, "must be set")
+		}
+	}
+	atLeast := func(key string, v *int, min int) {
+		if v != nil && *v < min {
+			add(Error, key, "must be at least %d, got %d", min, *v)
+		}
+	}
+	oneOf := func(key, value string, allowed ...string) {
+		if value != "" && !slices.Contains(allowed, value) {
+			add(Error, key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+		}
+	}
+
+	required("executableName", c.ExecutableName)
+	required("applicationName", c.ApplicationName)
+	switch {
+	case c.StreamName == "" && c.StreamArn == "":
+		add(Error, "streamName", "must be set, or streamArn")
+	case c.StreamName != "" && c.StreamArn != "":
+		add(Warning, "streamArn", "both streamName and streamArn are set, the KCL uses streamArn")
+	}
+	if c.StreamArn != "" {
+		arn := strings.Split(c.StreamArn, ":")
+		if len(arn) != 6 || arn[0] != "arn" || arn[2] != "kinesis" || !strings.HasPrefix(arn[5], "stream/") {
+			add(Error, "streamArn", "not a Kinesis stream ARN, got %q", c.StreamArn)
+		} else if c.RegionName != "" && arn[3] != c.RegionName {
+			add(Error, "regionName", "is %s but streamArn is in %s", c.RegionName, arn[3])
+		}
+	}
+
+	oneOf("initialPositionInStream", c.InitialPositionInStream, "TRIM_HORIZON", "LATEST", "AT_TIMESTAMP")
+	if c.InitialPositionInStream == "AT_TIMESTAMP" && c.InitialPositionInStreamExtended == nil {
+		add(Error, "initialPositionInStreamExtended", "must be set to a timestamp when initialPositionInStream is AT_TIMESTAMP")
+	}
+	if c.InitialPositionInStream != "AT_TIMESTAMP" && c.InitialPositionInStreamExtended != nil {
+		add(Warning, "initialPositionInStreamExtended", "is only used when initialPositionInStream is AT_TIMESTAMP")
+	}
+	if c.RegionName != "" && !validRegion(c.RegionName) {
+		add(Error, "regionName", "not an AWS region, got %q", c.RegionName)
+	}
+
+	atLeast("failoverTimeMillis", c.FailoverTimeMillis, 1)
+	atLeast("maxLeasesForWorker", c.MaxLeasesForWorker, 1)
+	atLeast("maxLeasesToStealAtOneTime", c.MaxLeasesToStealAtOneTime, 1)
+	atLeast("initialLeaseTableReadCapacity", c.InitialLeaseTableReadCapacity, 1)
+	atLeast("initialLeaseTableWriteCapacity", c.InitialLeaseTableWriteCapacity, 1)
+	atLeast("shardSyncIntervalMillis", c.ShardSyncIntervalMillis, 1)
+	if c.MaxLeasesForWorker != nil && c.MaxLeasesToStealAtOneTime != nil && *c.MaxLeasesToStealAtOneTime > *c.MaxLeasesForWorker {
+		add(Error, "maxLeasesToStealAtOneTime", "must not be more than maxLeasesForWorker (%d), got %d", *c.MaxLeasesForWorker, *c.MaxLeasesToStealAtOneTime)
+	}
+
+	oneOf("retrievalMode", c.RetrievalMode, "FANOUT", "POLLING")
+	if c.MaxRecords != nil && (*c.MaxRecords < 1 || *c.MaxRecords > 10000) {
+		add(Error, "maxRecords", "must be between 1 and 10000, got %d", *c.MaxRecords)
+	}
+	atLeast("idleTimeBetweenReadsInMillis", c.IdleTimeBetweenReadsInMillis, 0)
+	if c.RetrievalMode == "POLLING" && c.IdleTimeBetweenReadsInMillis != nil && *c.IdleTimeBetweenReadsInMillis < 200 {
+		add(Warning, "idleTimeBetweenReadsInMillis", "polling more often than every 200ms gets throttled, Kinesis allows 5 reads per second per shard")
+	}
+	if c.RetrievalMode != "POLLING" {
+		for _, key := range []string{"maxRecords", "idleTimeBetweenReadsInMillis"} {
+			if _, ok := c.lines[key]; ok {
+				add(Warning, key, "only applies with retrievalMode POLLING")
+			}
+		}
+	}
+	atLeast("parentShardPollIntervalMillis", c.ParentShardPollIntervalMillis, 1)
+	atLeast("taskBackoffTimeMillis", c.TaskBackoffTimeMillis, 1)
+
+	oneOf("metricsLevel", c.MetricsLevel, "NONE", "SUMMARY", "DETAILED")
+	atLeast("metricsBufferTimeMillis", c.MetricsBufferTimeMillis, 1)
+	atLeast("metricsMaxQueueSize", c.MetricsMaxQueueSize, 1)
+	return issues
+}
+
+// validRegion reports whether region looks like an AWS region, e.g.
+// us-east-1 or us-gov-west-1.
+func validRegion(region string) bool {
+	parts := strings.Split(region, "-")
+	if len(parts) < 3 {
+		return false
+	}
+	for _, part := range parts[:len(parts)-1] {
+		if part == "" || strings.Trim(part, "abcdefghijklmnopqrstuvwxyz") != "" {
+			return false
+		}
+	}
+	_, err := strconv.Atoi(parts[len(parts)-1])
+	return err == nil
+}
+
+// passThrough are settings the KCL knows that Config has no field for.
+// Keys with a dot, which set nested KCL settings, are passed on too.
+var passThrough = []string{
+	"AWSCredentialsProviderDynamoDB",
+	"AWSCredentialsProviderCloudWatch",
+	"metricsEnabledDimensions",
+	"validateSequenceNumberBeforeCheckpointing",
+	"shutdownGraceMillis",
+	"timeoutInSeconds",
+	"maxGetRecordsThreadPool",
+	"retryGetRecordsInSeconds",
+	"maxLeaseRenewalThreads",
+	"listShardsBackoffTimeInMillis",
+	"maxListShardsRetryAttempts",
+}
+
+// configFields maps the keys of Config's fields to their index.
+func configFields() map[string]int {
+	fields := map[string]int{}
+	t := reflect.TypeFor[Config]()
+	for i := range t.NumField() {
+		if key := t.Field(i).Tag.Get("properties"); key != "" {
+			fields[key] = i
+		}
+	}
+	return fields
+}
+
+func setField(f reflect.Value, value string) error {
+	switch f.Interface().(type) {
+	case string:
+		f.SetString(value)
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("must be a whole number, got %q", value)
+		}
+		f.Set(reflect.ValueOf(&n))
+	case *bool:
+		var b bool
+		switch strings.ToLower(value) {
+		case "true":
+			b = true
+		case "false":
+		default:
+			return fmt.Errorf("must be true or false, got %q", value)
+		}
+		f.Set(reflect.ValueOf(&b))
+	}
+	return nil
+}
+
+// suggest returns the known key closest to key, if it is close enough
+// to be a typo of it.
+func suggest(key string, fields map[string]int) string {
+	best, bestDist := "", 3
+	for known := range fields {
+		d := distance(strings.ToLower(key), strings.ToLower(known))
+		if d < bestDist || (d == bestDist && known < best) {
+			best, bestDist = known, d
+		}
+	}
+	return best
+}
+
+// distance returns the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,171 @@
+package properties
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lint(t *testing.T, s string) (*Config, []string) {
+	t.Helper()
+	p, err := Parse(strings.NewReader(s))
+	assert.NoError(t, err)
+	c, issues := Lint(p)
+	msgs := make([]string, len(issues))
+	for i, issue := range issues {
+		msgs[i] = issue.String()
+	}
+	return c, msgs
+}
+
+const minimal = `executableName = cmd/sample/sample
+streamName = my-stream
+applicationName = my-app
+`
+
+func TestLint(t *testing.T) {
+	t.Run("repo properties files are clean", func(t *testing.T) {
+		for _, path := range []string{"sample_kcl.properties", "advanced_kcl.properties"} {
+			p, err := Load(filepath.Join("..", "..", "..", path))
+			assert.NoError(t, err)
+			_, issues := Lint(p)
+			assert.Empty(t, issues, path)
+		}
+	})
+
+	t.Run("decodes typed values", func(t *testing.T) {
+		c, issues := lint(t, minimal+`initialPositionInStream = LATEST
+regionName = eu-west-1
+maxLeasesForWorker = 10
+cleanupLeasesUponShardCompletion = FALSE
+retrievalMode = POLLING
+maxRecords = 500
+metricsEnabledDimensions = Operation
+coordinatorConfig.shardConsumerDispatchPollIntervalMillis = 500
+`)
+		assert.Empty(t, issues)
+		assert.Equal(t, "cmd/sample/sample", c.ExecutableName)
+		assert.Equal(t, "LATEST", c.InitialPositionInStream)
+		assert.Equal(t, "eu-west-1", c.RegionName)
+		assert.Equal(t, 10, *c.MaxLeasesForWorker)
+		assert.False(t, *c.CleanupLeasesUponShardCompletion)
+		assert.Equal(t, 500, *c.MaxRecords)
+		assert.Nil(t, c.FailoverTimeMillis)
+		assert.Equal(t, map[string]string{
+			"metricsEnabledDimensions":                                  "Operation",
+			"coordinatorConfig.shardConsumerDispatchPollIntervalMillis": "500",
+		}, c.Extra)
+		assert.Equal(t, 9, c.Line("maxRecords"))
+	})
+
+	t.Run("reports line numbered issues", func(t *testing.T) {
+		_, issues := lint(t, `executableName = cmd/sample/sample
+applicationName = my-app
+initialPositionInStream = TRIM_HORIZ
+maxRecords = lots
+cleanupLeasesUponShardCompletion = yes
+regionName = useast1
+initialPositonInStream = LATEST
+`)
+		assert.Equal(t, []string{
+			"streamName: must be set, or streamArn",
+			`line 3: initialPositionInStream: must be one of TRIM_HORIZON, LATEST, AT_TIMESTAMP, got "TRIM_HORIZ"`,
+			`line 4: maxRecords: must be a whole number, got "lots"`,
+			"line 4: warning: maxRecords: only applies with retrievalMode POLLING",
+			`line 5: cleanupLeasesUponShardCompletion: must be true or false, got "yes"`,
+			`line 6: regionName: not an AWS region, got "useast1"`,
+			"line 7: warning: initialPositonInStream: unknown setting, did you mean initialPositionInStream?",
+		}, issues)
+	})
+
+	t.Run("checks rules between settings", func(t *testing.T) {
+		_, issues := lint(t, minimal+`streamArn = arn:aws:kinesis:us-east-1:123456789012:stream/my-stream
+regionName = eu-west-1
+initialPositionInStream = AT_TIMESTAMP
+maxLeasesForWorker = 2
+maxLeasesToStealAtOneTime = 5
+maxRecords = 20000
+`)
+		assert.Equal(t, []string{
+			"initialPositionInStreamExtended: must be set to a timestamp when initialPositionInStream is AT_TIMESTAMP",
+			"line 4: warning: streamArn: both streamName and streamArn are set, the KCL uses streamArn",
+			"line 5: regionName: is eu-west-1 but streamArn is in us-east-1",
+			"line 8: maxLeasesToStealAtOneTime: must not be more than maxLeasesForWorker (2), got 5",
+			"line 9: maxRecords: must be between 1 and 10000, got 20000",
+			"line 9: warning: maxRecords: only applies with retrievalMode POLLING",
+		}, issues)
+	})
+}
+
+func TestDecode(t *testing.T) {
+	t.Run("ignores warnings", func(t *testing.T) {
+		p, err := Parse(strings.NewReader(minimal + "mystery = 1\n"))
+		assert.NoError(t, err)
+		c, err := p.Decode()
+		assert.NoError(t, err)
+		assert.Equal(t, "my-app", c.ApplicationName)
+	})
+
+	t.Run("returns errors", func(t *testing.T) {
+		p, err := Parse(strings.NewReader(minimal + "maxRecords = 0\nmystery = 1\n"))
+		assert.NoError(t, err)
+		_, err = p.Decode()
+		var verr *ValidationError
+		if assert.ErrorAs(t, err, &verr) {
+			assert.Len(t, verr.Issues, 1)
+		}
+		assert.EqualError(t, err, "line 4: maxRecords: must be between 1 and 10000, got 0")
+	})
+}
+
+func TestValidate(t *testing.T) {
+	c := &Config{ExecutableName: "sample", StreamName: "s", ApplicationName: "a"}
+	assert.NoError(t, c.Validate())
+
+	c.MetricsLevel = "VERBOSE"
+	assert.EqualError(t, c.Validate(), `metricsLevel: must be one of NONE, SUMMARY, DETAILED, got "VERBOSE"`)
+}
+
+func TestWriteTo(t *testing.T) {
+	t.Run("round trips", func(t *testing.T) {
+		maxRecords, cleanup := 100, true
+		c := &Config{
+			ExecutableName:                   "/opt/my processor --flag=a:b",
+			StreamName:                       "my-stream",
+			ApplicationName:                  " café #1 😀",
+			MaxRecords:                       &maxRecords,
+			CleanupLeasesUponShardCompletion: &cleanup,
+			Extra:                            map[string]string{"b.key": "2", "a key": "1"},
+		}
+		var buf bytes.Buffer
+		_, err := c.WriteTo(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, `executableName = /opt/my processor --flag\=a\:b
+streamName = my-stream
+applicationName = \ caf\u00e9 \#1 \ud83d\ude00
+cleanupLeasesUponShardCompletion = true
+maxRecords = 100
+a\ key = 1
+b.key = 2
+`, buf.String())
+
+		p, err := Parse(&buf)
+		assert.NoError(t, err)
+		got, issues := Lint(p)
+		got.lines = nil
+		assert.Equal(t, c, got)
+		assert.Len(t, issues, 2) // maxRecords without POLLING, unknown key
+	})
+
+	t.Run("writes file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "kcl.properties")
+		c := &Config{ExecutableName: "sample", StreamName: "s", ApplicationName: "a"}
+		assert.NoError(t, c.WriteFile(path))
+		got, err := LoadConfig(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "sample", got.ExecutableName)
+	})
+}
@@ -0,0 +1,170 @@
+// Package properties reads the Java properties files the KCL
+// MultiLangDaemon is configured with, e.g. sample_kcl.properties.
+package properties
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Entry is a single key value pair and the line it starts on.
+type Entry struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+// Properties are the entries of a properties file, in file order.
+type Properties struct {
+	Entries []Entry
+}
+
+// Load parses the properties file at path.
+func Load(path string) (*Properties, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse parses a properties file. It follows java.util.Properties:
+// keys and values are separated by '=', ':' or whitespace, lines
+// starting with '#' or '!' are comments and a trailing backslash
+// continues the line.
+func Parse(r io.Reader) (*Properties, error) {
+	p := &Properties{}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		start := lineNum
+		line := strings.TrimLeft(scanner.Text(), " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		for continues(line) && scanner.Scan() {
+			lineNum++
+			line = line[:len(line)-1] + strings.TrimLeft(scanner.Text(), " \t\f")
+		}
+		key, value := split(line)
+		key, err := unescape(key)
+		if err != nil {
+			return p, fmt.Errorf("line %d: %w", start, err)
+		}
+		value, err = unescape(value)
+		if err != nil {
+			return p, fmt.Errorf("line %d: %w", start, err)
+		}
+		p.Entries = append(p.Entries, Entry{Key: key, Value: value, Line: start})
+	}
+	return p, scanner.Err()
+}
+
+// continues reports whether line ends in an odd number of backslashes.
+func continues(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// split splits a logical line into its raw key and value.
+func split(line string) (string, string) {
+	i := 0
+	for ; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' {
+			i++
+			continue
+		}
+		if c == '=' || c == ':' || c == ' ' || c == '\t' || c == '\f' {
+			break
+		}
+	}
+	if i >= len(line) {
+		return line, ""
+	}
+	key := line[:i]
+	rest := strings.TrimLeft(line[i:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	return key, rest
+}
+
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i == len(s)-1 {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(s) {
+				return "", fmt.Errorf("malformed \\uxxxx escape")
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("malformed \\uxxxx escape")
+			}
+			i += 4
+			// characters outside the BMP are escaped as surrogate pairs
+			if utf16.IsSurrogate(rune(r)) && i+6 < len(s) && s[i+1:i+3] == `\u` {
+				low, err := strconv.ParseUint(s[i+3:i+7], 16, 32)
+				if err == nil && utf16.DecodeRune(rune(r), rune(low)) != utf8.RuneError {
+					sb.WriteRune(utf16.DecodeRune(rune(r), rune(low)))
+					i += 6
+					continue
+				}
+			}
+			sb.WriteRune(rune(r))
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// Get returns the value of key, and false if it is not set. When a key
+// is set more than once the last value wins, like in Java.
+func (p *Properties) Get(key string) (string, bool) {
+	e, ok := p.Lookup(key)
+	return e.Value, ok
+}
+
+// Lookup returns the entry for key, and false if it is not set.
+func (p *Properties) Lookup(key string) (Entry, bool) {
+	for i := len(p.Entries) - 1; i >= 0; i-- {
+		if p.Entries[i].Key == key {
+			return p.Entries[i], true
+		}
+	}
+	return Entry{}, false
+}
@@ -0,0 +1,49 @@
+package properties
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("parses java properties syntax", func(t *testing.T) {
+		p, err := Parse(strings.NewReader(`# comment
+! also a comment
+executableName = cmd/sample/sample
+streamName:my-stream
+applicationName my-app
+  regionName   =   us-east-1
+multi = a,\
+        b
+escaped\ key = tab\there \u00e9
+empty
+`))
+		assert.NoError(t, err)
+		assert.Equal(t, []Entry{
+			{Key: "executableName", Value: "cmd/sample/sample", Line: 3},
+			{Key: "streamName", Value: "my-stream", Line: 4},
+			{Key: "applicationName", Value: "my-app", Line: 5},
+			{Key: "regionName", Value: "us-east-1", Line: 6},
+			{Key: "multi", Value: "a,b", Line: 7},
+			{Key: "escaped key", Value: "tab\there é", Line: 9},
+			{Key: "empty", Value: "", Line: 10},
+		}, p.Entries)
+	})
+
+	t.Run("last value wins", func(t *testing.T) {
+		p, err := Parse(strings.NewReader("a = 1\na = 2\n"))
+		assert.NoError(t, err)
+		v, ok := p.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, "2", v)
+		_, ok = p.Get("b")
+		assert.False(t, ok)
+	})
+
+	t.Run("reports line of bad escape", func(t *testing.T) {
+		_, err := Parse(strings.NewReader("a = 1\nb = \\uzzzz\n"))
+		assert.EqualError(t, err, `line 2: malformed \uxxxx escape`)
+	})
+}
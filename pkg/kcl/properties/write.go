@@ -0,0 +1,123 @@
+package properties
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// WriteTo writes c as a properties file, one "key = value" line per set
+// field in the order of Config, followed by Extra in key order. Keys and
+// values are escaped so the KCL reads back the same values, and non
+// ASCII characters written as \uxxxx since Java reads properties files
+// as ISO-8859-1.
+func (c *Config) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var n int64
+	write := func(key, value string) error {
+		m, err := fmt.Fprintf(bw, "%s = %s\n", escape(key, true), escape(value, false))
+		n += int64(m)
+		return err
+	}
+
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := range t.NumField() {
+		key := t.Field(i).Tag.Get("properties")
+		if key == "" {
+			continue
+		}
+		value, ok := fieldValue(v.Field(i))
+		if !ok {
+			continue
+		}
+		if err := write(key, value); err != nil {
+			return n, err
+		}
+	}
+	keys := make([]string, 0, len(c.Extra))
+	for key := range c.Extra {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if err := write(key, c.Extra[key]); err != nil {
+			return n, err
+		}
+	}
+	return n, bw.Flush()
+}
+
+// fieldValue formats a Config field, and false if it is not set.
+func fieldValue(f reflect.Value) (string, bool) {
+	switch v := f.Interface().(type) {
+	case string:
+		return v, v != ""
+	case *int:
+		if v == nil {
+			return "", false
+		}
+		return strconv.Itoa(*v), true
+	case *bool:
+		if v == nil {
+			return "", false
+		}
+		return strconv.FormatBool(*v), true
+	}
+	return "", false
+}
+
+// escape escapes s like java.util.Properties.store does. Spaces are only
+// escaped in keys, and at the start of values.
+func escape(s string, key bool) string {
+	var sb strings.Builder
+	for i, r := range s {
+		switch r {
+		case ' ':
+			if key || i == 0 {
+				sb.WriteByte('\\')
+			}
+			sb.WriteByte(' ')
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '=', ':', '#', '!', '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		default:
+			if r < 0x20 || r > 0x7e {
+				for _, u := range utf16.Encode([]rune{r}) {
+					fmt.Fprintf(&sb, `\u%04x`, u)
+				}
+				continue
+			}
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// WriteFile writes c to the properties file at path.
+func (c *Config) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = c.WriteTo(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,259 @@
+package kcl
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+)
+
+// RouteHandler handles the records of a batch that were routed to it,
+// in the order they appear in the batch. Returning a RecordError tells
+// the Router exactly which record failed; any other error marks every
+// record handed to the handler as failed.
+type RouteHandler func(records []actions.Record) error
+
+// ErrNoRoute is wrapped in the RecordError returned when a record does
+// not match any route and the Router has no fallback handler.
+var ErrNoRoute = errors.New("no route matches record")
+
+type route struct {
+	match   func(r *routedRecord) bool
+	handler RouteHandler
+}
+
+// routedRecord caches the decoded record data so it is only decoded
+// once no matter how many json routes are checked.
+type routedRecord struct {
+	actions.Record
+	decoded    bool
+	decodedErr error
+	doc        any
+}
+
+func (rr *routedRecord) json() (any, error) {
+	if !rr.decoded {
+		rr.decoded = true
+		var data []byte
+		data, rr.decodedErr = base64.StdEncoding.DecodeString(rr.Data)
+		if rr.decodedErr == nil {
+			rr.decodedErr = json.Unmarshal(data, &rr.doc)
+		}
+	}
+	return rr.doc, rr.decodedErr
+}
+
+// Router is a RecordProcessor that dispatches every record of a batch
+// to the first registered route matching it. Records are grouped per
+// handler so each handler is called at most once per batch.
+//
+// A batch is only considered done once every handler it was routed to
+// has finished. If all handlers succeed the Router checkpoints the
+// batch. If any fail, ProcessRecords returns a RecordError for the
+// earliest failed record in the batch, so the records before it are
+// what the embedded RecordProcessorFuncs considers processed (and what
+// its default ShutdownRequested checkpoints), and a DeadLetterPolicy
+// can retry or dead letter it. Note that on a retry, records after the
+// failed one are redelivered to every handler, including handlers that
+// had already succeeded. A record no route matches, without a fallback,
+// fails like a handler failing on it: the records before it are still
+// handled, the ones after it are not.
+//
+// Router embeds RecordProcessorFuncs for the other lifecycle methods,
+// so their defaults apply and can be overridden in the same way.
+type Router struct {
+	RecordProcessorFuncs
+
+	routes          []route
+	fallback        RouteHandler
+	concurrent      bool
+	checkpointBatch bool
+}
+
+type RouterOpts func(rt *Router)
+
+// NewRouter creates a Router without any routes.
+func NewRouter(opts ...RouterOpts) *Router {
+	rt := &Router{checkpointBatch: true}
+	for _, opt := range opts {
+		opt(rt)
+	}
+	rt.ProcessRecordsFunc = rt.route
+	return rt
+}
+
+// WithConcurrentHandlers runs the handlers of a batch concurrently
+// instead of one after the other in registration order.
+func WithConcurrentHandlers() RouterOpts {
+	return func(rt *Router) {
+		rt.concurrent = true
+	}
+}
+
+// WithoutBatchCheckpoint stops the Router from checkpointing after every
+// successful batch, leaving checkpointing to the handlers or to the
+// lifecycle defaults.
+func WithoutBatchCheckpoint() RouterOpts {
+	return func(rt *Router) {
+		rt.checkpointBatch = false
+	}
+}
+
+// HandleFunc routes records for which match returns true to h.
+func (rt *Router) HandleFunc(match func(r actions.Record) bool, h RouteHandler) {
+	rt.routes = append(rt.routes, route{
+		match:   func(rr *routedRecord) bool { return match(rr.Record) },
+		handler: h,
+	})
+}
+
+// HandlePartitionKey routes records whose partition key matches the
+// regular expression pattern to h. It panics if pattern does not
+// compile.
+func (rt *Router) HandlePartitionKey(pattern string, h RouteHandler) {
+	re := regexp.MustCompile(pattern)
+	rt.routes = append(rt.routes, route{
+		match:   func(rr *routedRecord) bool { return re.MatchString(rr.PartitionKey) },
+		handler: h,
+	})
+}
+
+// HandleJSONField routes records whose data is a json object with field
+// equal to value to h. Nested fields can be addressed with dots, e.g.
+// "meta.type". Non string values are compared using their default
+// formatting, so a field holding the number 2 matches the value "2".
+// Records whose data is not json never match.
+func (rt *Router) HandleJSONField(field, value string, h RouteHandler) {
+	path := strings.Split(field, ".")
+	rt.routes = append(rt.routes, route{
+		match: func(rr *routedRecord) bool {
+			doc, err := rr.json()
+			if err != nil {
+				return false
+			}
+			v, ok := lookupJSONField(doc, path)
+			return ok && fmt.Sprint(v) == value
+		},
+		handler: h,
+	})
+}
+
+// lookupJSONField walks path through the nested json objects of doc.
+func lookupJSONField(doc any, path []string) (any, bool) {
+	for _, key := range path {
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		doc, ok = obj[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// Fallback sets the handler for records that do not match any route.
+func (rt *Router) Fallback(h RouteHandler) {
+	rt.fallback = h
+}
+
+// routedBatch is the part of a batch routed to a single handler,
+// along with the index of each record in the original batch.
+type routedBatch struct {
+	handler RouteHandler
+	records []actions.Record
+	indexes []int
+}
+
+func (rt *Router) route(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+	batches := make([]*routedBatch, len(rt.routes)+1)
+	// the first record without a route, whose error is returned once
+	// the records before it are handled
+	unroutable := -1
+	for i, r := range records {
+		rr := &routedRecord{Record: r}
+		dest := len(rt.routes)
+		for j, rte := range rt.routes {
+			if rte.match(rr) {
+				dest = j
+				break
+			}
+		}
+		if dest == len(rt.routes) && rt.fallback == nil {
+			// the records after this one are not handed off, since they
+			// could not be considered done before it is
+			unroutable = i
+			break
+		}
+		if batches[dest] == nil {
+			h := rt.fallback
+			if dest < len(rt.routes) {
+				h = rt.routes[dest].handler
+			}
+			batches[dest] = &routedBatch{handler: h}
+		}
+		batches[dest].records = append(batches[dest].records, r)
+		batches[dest].indexes = append(batches[dest].indexes, i)
+	}
+
+	errs := make([]error, len(batches))
+	var wg sync.WaitGroup
+	for i, b := range batches {
+		if b == nil {
+			continue
+		}
+		if !rt.concurrent {
+			errs[i] = b.handler(b.records)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = b.handler(b.records)
+		}()
+	}
+	wg.Wait()
+
+	// find the earliest record in the batch that was not handled
+	failedIdx := -1
+	var failedErr error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		b := batches[i]
+		idx := b.indexes[0]
+		var recErr *RecordError
+		if errors.As(err, &recErr) {
+			if j := recordIndex(b.records, recErr.Record); j >= 0 {
+				idx = b.indexes[j]
+			}
+		}
+		if failedIdx < 0 || idx < failedIdx {
+			failedIdx = idx
+			failedErr = err
+		}
+	}
+	if failedIdx >= 0 {
+		var recErr *RecordError
+		if errors.As(failedErr, &recErr) && sameRecord(recErr.Record, records[failedIdx]) {
+			return failedErr
+		}
+		return NewRecordError(records[failedIdx], failedErr)
+	}
+	if unroutable >= 0 {
+		return NewRecordError(records[unroutable], ErrNoRoute)
+	}
+
+	if rt.checkpointBatch && len(records) > 0 {
+		return cp.CheckpointBatch()
+	}
+	return nil
+}
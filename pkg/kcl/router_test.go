@@ -0,0 +1,165 @@
+package kcl
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/stretchr/testify/assert"
+)
+
+// routeRecorder is a RouteHandler recording the sequence numbers it was
+// handed and optionally failing on one of them.
+type routeRecorder struct {
+	mu     sync.Mutex
+	got    []string
+	failOn string
+}
+
+func (rr *routeRecorder) handle(records []actions.Record) error {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	for _, r := range records {
+		if r.SequenceNumber == rr.failOn {
+			return NewRecordError(r, errors.New("handler failed"))
+		}
+		rr.got = append(rr.got, r.SequenceNumber)
+	}
+	return nil
+}
+
+func jsonRecord(seqNum, partKey string, doc any) actions.Record {
+	data, _ := json.Marshal(doc)
+	return actions.Record{
+		SequenceNumber: seqNum,
+		PartitionKey:   partKey,
+		Data:           base64.StdEncoding.EncodeToString(data),
+	}
+}
+
+func routerProcessAction(records ...actions.Record) actions.RawAction {
+	actionBytes, _ := json.Marshal(actions.ProcessAction{Action: actions.PROCESS_RECORDS, Records: records})
+	rAction, _ := actions.NewRawAction(string(actionBytes))
+	return rAction
+}
+
+func TestRouter(t *testing.T) {
+	t.Run("routes records and checkpoints batch", func(t *testing.T) {
+		orders, refunds, users, other := &routeRecorder{}, &routeRecorder{}, &routeRecorder{}, &routeRecorder{}
+		rt := NewRouter()
+		rt.HandleJSONField("type", "order", orders.handle)
+		rt.HandleJSONField("meta.kind", "refund", refunds.handle)
+		rt.HandlePartitionKey(`^user-\d+$`, users.handle)
+		rt.Fallback(other.handle)
+
+		mockReader := bytes.NewBufferString(checkpointAck)
+		mockWriter := &bytes.Buffer{}
+		manager := NewManager(mockReader, mockWriter, rt)
+
+		err := manager.processRawAction(routerProcessAction(
+			jsonRecord("1", "a", map[string]any{"type": "order"}),
+			jsonRecord("2", "user-1", map[string]any{"type": "login"}),
+			jsonRecord("3", "b", map[string]any{"meta": map[string]any{"kind": "refund"}}),
+			actions.Record{SequenceNumber: "4", PartitionKey: "c", Data: "bm90IGpzb24="},
+			jsonRecord("5", "d", map[string]any{"type": "order"}),
+		))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1", "5"}, orders.got)
+		assert.Equal(t, []string{"3"}, refunds.got)
+		assert.Equal(t, []string{"2"}, users.got)
+		assert.Equal(t, []string{"4"}, other.got)
+		assert.JSONEq(t, `{"action":"checkpoint"}`, mockWriter.String())
+	})
+
+	t.Run("routes with custom selector", func(t *testing.T) {
+		big, small := &routeRecorder{}, &routeRecorder{}
+		rt := NewRouter(WithoutBatchCheckpoint())
+		rt.HandleFunc(func(r actions.Record) bool { return len(r.Data) > 4 }, big.handle)
+		rt.Fallback(small.handle)
+
+		mockWriter := &bytes.Buffer{}
+		manager := NewManager(&bytes.Buffer{}, mockWriter, rt)
+
+		err := manager.processRawAction(routerProcessAction(
+			actions.Record{SequenceNumber: "1", Data: "YQ=="},
+			actions.Record{SequenceNumber: "2", Data: "YWJjZGVm"},
+		))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"2"}, big.got)
+		assert.Equal(t, []string{"1"}, small.got)
+		assert.Empty(t, mockWriter.String())
+	})
+
+	t.Run("reports earliest failed record across handlers", func(t *testing.T) {
+		evens, odds := &routeRecorder{failOn: "4"}, &routeRecorder{failOn: "3"}
+		rt := NewRouter(WithConcurrentHandlers())
+		rt.HandlePartitionKey("even", evens.handle)
+		rt.HandlePartitionKey("odd", odds.handle)
+
+		mockWriter := &bytes.Buffer{}
+		manager := NewManager(&bytes.Buffer{}, mockWriter, rt)
+
+		err := manager.processRawAction(routerProcessAction(
+			actions.Record{SequenceNumber: "1", PartitionKey: "odd"},
+			actions.Record{SequenceNumber: "2", PartitionKey: "even"},
+			actions.Record{SequenceNumber: "3", PartitionKey: "odd"},
+			actions.Record{SequenceNumber: "4", PartitionKey: "even"},
+			actions.Record{SequenceNumber: "5", PartitionKey: "odd"},
+		))
+		var recErr *RecordError
+		if assert.ErrorAs(t, err, &recErr) {
+			assert.Equal(t, "3", recErr.Record.SequenceNumber)
+		}
+		// nothing is checkpointed and only the records before the failure
+		// are considered processed
+		assert.Empty(t, mockWriter.String())
+		last, ok := rt.LastProcessed()
+		assert.True(t, ok)
+		assert.Equal(t, "2", last.SequenceNumber)
+	})
+
+	t.Run("fails on unroutable record without fallback", func(t *testing.T) {
+		handled := &routeRecorder{}
+		rt := NewRouter()
+		rt.HandlePartitionKey("^known$", handled.handle)
+
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, rt)
+
+		err := manager.processRawAction(routerProcessAction(
+			actions.Record{SequenceNumber: "1", PartitionKey: "known"},
+			actions.Record{SequenceNumber: "2", PartitionKey: "unknown"},
+		))
+		assert.ErrorIs(t, err, ErrNoRoute)
+		assert.Equal(t, []string{"1"}, handled.got)
+		last, ok := rt.LastProcessed()
+		assert.True(t, ok)
+		assert.Equal(t, "1", last.SequenceNumber)
+	})
+
+	t.Run("handles records before unroutable record under dead letter policy", func(t *testing.T) {
+		handled := &routeRecorder{}
+		rt := NewRouter()
+		rt.HandlePartitionKey("^known$", handled.handle)
+		sink := &recordingSink{}
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, rt, WithDeadLetterPolicy(DeadLetterPolicy{Sink: sink}))
+
+		err := manager.processRecords(actions.RawAction{ActionType: actions.PROCESS_RECORDS}, actions.ProcessAction{
+			Action: actions.PROCESS_RECORDS,
+			Records: []actions.Record{
+				{SequenceNumber: "1", PartitionKey: "known"},
+				{SequenceNumber: "2", PartitionKey: "known"},
+				{SequenceNumber: "3", PartitionKey: "unknown"},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1", "2"}, handled.got)
+		if assert.Len(t, sink.sent, 1) {
+			assert.Equal(t, "3", sink.sent[0].Record.SequenceNumber)
+			assert.ErrorIs(t, sink.sent[0].Err, ErrNoRoute)
+		}
+	})
+}
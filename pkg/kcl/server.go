@@ -0,0 +1,73 @@
+package kcl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// handle registers h under pattern on the HTTP server listening on
+// addr, creating that server if needed. Handlers registered on the same
+// addr share a server. Servers are started by Run and Start.
+func (kclm *Manager) handle(addr, pattern string, h http.Handler) {
+	if kclm.muxes == nil {
+		kclm.muxes = make(map[string]*http.ServeMux)
+	}
+	mux, ok := kclm.muxes[addr]
+	if !ok {
+		mux = http.NewServeMux()
+		kclm.muxes[addr] = mux
+	}
+	mux.Handle(pattern, h)
+}
+
+// startServers starts listening on every configured address. An
+// address with port 0 picks a free port, which is logged and reported by
+// ServerAddrs.
+func (kclm *Manager) startServers() error {
+	for addr, mux := range kclm.muxes {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			kclm.stopServers()
+			return fmt.Errorf("error listening on %s: %w", addr, err)
+		}
+		srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+		kclm.mu.Lock()
+		kclm.servers = append(kclm.servers, srv)
+		kclm.serverAddrs = append(kclm.serverAddrs, ln.Addr().String())
+		kclm.mu.Unlock()
+		loggr := kclm.loggr
+		loggr.Info("serving manager http endpoints", "addr", ln.Addr().String())
+		go func() {
+			err := srv.Serve(ln)
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				loggr.Error("manager http server stopped", "addr", ln.Addr().String(), "error", err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (kclm *Manager) stopServers() {
+	kclm.mu.Lock()
+	servers := kclm.servers
+	kclm.servers = nil
+	kclm.serverAddrs = nil
+	kclm.mu.Unlock()
+	for _, srv := range servers {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		srv.Shutdown(ctx)
+		cancel()
+	}
+}
+
+// ServerAddrs returns the addresses the manager's HTTP endpoints are
+// being served on while Run or Start is in progress.
+func (kclm *Manager) ServerAddrs() []string {
+	kclm.mu.Lock()
+	defer kclm.mu.Unlock()
+	return append([]string(nil), kclm.serverAddrs...)
+}
@@ -0,0 +1,213 @@
+package kcl
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl"
+
+// RecordCarrierFunc extracts the trace context a producer attached to a
+// record. It returns nil if the record does not carry any.
+type RecordCarrierFunc func(r actions.Record) propagation.TextMapCarrier
+
+// WithTracerProvider sets the OpenTelemetry TracerProvider the manager
+// creates spans with. By default the global provider is used, which
+// does nothing unless one was registered with otel.SetTracerProvider.
+func WithTracerProvider(tp trace.TracerProvider) ManagerOpts {
+	return func(kclm *Manager) {
+		kclm.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// WithRecordTracing creates a span for every record handed to the
+// RecordProcessor, linked to the producer's trace found by carrier. The
+// trace context is read with the W3C trace context propagator unless
+// WithTracePropagator says otherwise. See JSONFieldCarrier for records
+// carrying their trace context in a json field or header envelope.
+func WithRecordTracing(carrier RecordCarrierFunc) ManagerOpts {
+	return func(kclm *Manager) {
+		kclm.recordCarrier = carrier
+	}
+}
+
+// WithTracePropagator sets the propagator used to read the trace context
+// of records when record tracing is enabled.
+func WithTracePropagator(p propagation.TextMapPropagator) ManagerOpts {
+	return func(kclm *Manager) {
+		kclm.propagator = p
+	}
+}
+
+// JSONFieldCarrier reads trace context from field of records whose data
+// is a json object. Nested fields can be addressed with dots. If the
+// field holds a string it is used as the W3C traceparent. If it holds an
+// object (e.g. a "headers" envelope) its string values are used as
+// propagation headers, such as "traceparent" and "tracestate".
+func JSONFieldCarrier(field string) RecordCarrierFunc {
+	path := strings.Split(field, ".")
+	return func(r actions.Record) propagation.TextMapCarrier {
+		data, err := base64.StdEncoding.DecodeString(r.Data)
+		if err != nil {
+			return nil
+		}
+		var doc any
+		err = json.Unmarshal(data, &doc)
+		if err != nil {
+			return nil
+		}
+		v, ok := lookupJSONField(doc, path)
+		if !ok {
+			return nil
+		}
+		switch v := v.(type) {
+		case string:
+			return propagation.MapCarrier{"traceparent": v}
+		case map[string]any:
+			carrier := propagation.MapCarrier{}
+			for k, hv := range v {
+				if s, ok := hv.(string); ok {
+					carrier[strings.ToLower(k)] = s
+				}
+			}
+			return carrier
+		}
+		return nil
+	}
+}
+
+func (kclm *Manager) tracerOrGlobal() trace.Tracer {
+	if kclm.tracer == nil {
+		return otel.GetTracerProvider().Tracer(tracerName)
+	}
+	return kclm.tracer
+}
+
+// startActionSpan starts the span covering a whole action and makes it
+// the parent of any checkpoint spans created while handling it, until
+// endActionSpan ends it.
+func (kclm *Manager) startActionSpan(ra actions.RawAction) trace.Span {
+	kind := trace.SpanKindInternal
+	if ra.ActionType == actions.PROCESS_RECORDS {
+		kind = trace.SpanKindConsumer
+	}
+	ctx, span := kclm.tracerOrGlobal().Start(context.Background(), ra.ActionType,
+		trace.WithSpanKind(kind),
+		trace.WithAttributes(attribute.String("kcl.action", ra.ActionType)),
+	)
+	kclm.actionCtx = ctx
+	return span
+}
+
+// endActionSpan ends the span started by startActionSpan, so nothing
+// happening between actions is parented to it.
+func (kclm *Manager) endActionSpan(span trace.Span, err error) {
+	endSpan(span, err)
+	kclm.actionCtx = context.Background()
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func batchAttributes(a actions.ProcessAction) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.Int("kcl.record_count", len(a.Records)),
+		attribute.Int("kcl.millis_behind_latest", a.MillisBehindLatest),
+	}
+	if len(a.Records) > 0 {
+		attrs = append(attrs,
+			attribute.String("kcl.first_sequence_number", a.Records[0].SequenceNumber),
+			attribute.String("kcl.last_sequence_number", a.Records[len(a.Records)-1].SequenceNumber),
+		)
+	}
+	return attrs
+}
+
+// startRecordSpans starts a span per record linked to the trace context
+// the record was produced with. They are ended by endRecordSpans once
+// the RecordProcessor is done with the batch.
+func (kclm *Manager) startRecordSpans(records []actions.Record) []trace.Span {
+	if kclm.recordCarrier == nil {
+		return nil
+	}
+	propagator := kclm.propagator
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+	spans := make([]trace.Span, len(records))
+	for i, r := range records {
+		opts := []trace.SpanStartOption{
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("kcl.shard_id", kclm.shardId),
+				attribute.String("kcl.sequence_number", r.SequenceNumber),
+				attribute.Int("kcl.sub_sequence_number", r.SubSequenceNumber),
+				attribute.String("kcl.partition_key", r.PartitionKey),
+			),
+		}
+		if carrier := kclm.recordCarrier(r); carrier != nil {
+			producer := trace.SpanContextFromContext(propagator.Extract(context.Background(), carrier))
+			if producer.IsValid() {
+				opts = append(opts, trace.WithLinks(trace.Link{SpanContext: producer}))
+			}
+		}
+		_, spans[i] = kclm.tracerOrGlobal().Start(kclm.actionCtx, "record", opts...)
+	}
+	return spans
+}
+
+// endRecordSpans ends the spans started by startRecordSpans. If the
+// batch failed with a RecordError only that record's span is marked as
+// failed, otherwise they all are.
+func endRecordSpans(spans []trace.Span, records []actions.Record, err error) {
+	var recErr *RecordError
+	isRecErr := errors.As(err, &recErr)
+	for i, span := range spans {
+		if isRecErr && !sameRecord(records[i], recErr.Record) {
+			span.End()
+			continue
+		}
+		endSpan(span, err)
+	}
+}
+
+// traceCheckpoint records a checkpoint round trip as a child span of
+// the action it happened during.
+func (kclm *Manager) traceCheckpoint(o checkpoint.Observation) {
+	ctx := kclm.actionCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	attrs := []attribute.KeyValue{attribute.String("kcl.shard_id", kclm.shardId)}
+	if o.SeqNum != nil {
+		attrs = append(attrs, attribute.String("kcl.sequence_number", *o.SeqNum))
+	}
+	if o.SubSeqNum != nil {
+		attrs = append(attrs, attribute.Int("kcl.sub_sequence_number", *o.SubSeqNum))
+	}
+	_, span := kclm.tracerOrGlobal().Start(ctx, "checkpoint",
+		trace.WithTimestamp(o.Start),
+		trace.WithAttributes(attrs...),
+	)
+	if o.Err != nil {
+		span.RecordError(o.Err)
+		span.SetStatus(codes.Error, o.Err.Error())
+	}
+	span.End(trace.WithTimestamp(o.Start.Add(o.Duration)))
+}
@@ -0,0 +1,94 @@
+// Package tracing builds OpenTelemetry TracerProviders suitable for a
+// KCL Multilang child process, for use with kcl.WithTracerProvider.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+type Config struct {
+	// Exporter is one of ExporterNone, ExporterStdout or ExporterOTLP.
+	// When empty the OTEL_TRACES_EXPORTER environment variable is used,
+	// falling back to ExporterNone.
+	Exporter string
+	// Writer is where the stdout exporter writes spans. It defaults to
+	// stderr, since stdout is reserved for talking to the KCL Multilang
+	// process and anything else written there corrupts the protocol.
+	Writer io.Writer
+	// OTLPEndpoint is the host:port of the OTLP/HTTP collector. When
+	// empty the standard OTEL_EXPORTER_OTLP_* environment variables
+	// apply, falling back to localhost:4318.
+	OTLPEndpoint string
+	// OTLPInsecure disables TLS for the OTLP exporter.
+	OTLPInsecure bool
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string
+}
+
+// NewTracerProvider creates a TracerProvider exporting spans as
+// configured by cfg, along with a function that flushes and stops it.
+// The shutdown function should be called before the process exits.
+func NewTracerProvider(ctx context.Context, cfg Config) (trace.TracerProvider, func(context.Context) error, error) {
+	exporter := cfg.Exporter
+	if exporter == "" {
+		exporter = os.Getenv("OTEL_TRACES_EXPORTER")
+	}
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "", ExporterNone:
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		w := cfg.Writer
+		if w == nil {
+			w = os.Stderr
+		}
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(w))
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.OTLPEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.OTLPEndpoint))
+		}
+		if cfg.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		spanExporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, nil, fmt.Errorf("unsupported trace exporter: %s", exporter)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating %s trace exporter: %w", exporter, err)
+	}
+
+	var attrs []attribute.KeyValue
+	if cfg.ServiceName != "" {
+		attrs = append(attrs, attribute.String("service.name", cfg.ServiceName))
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attrs...))
+	if err != nil {
+		return nil, nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+	return tp, tp.Shutdown, nil
+}
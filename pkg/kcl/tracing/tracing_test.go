@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestNewTracerProvider(t *testing.T) {
+	t.Run("defaults to no-op", func(t *testing.T) {
+		t.Setenv("OTEL_TRACES_EXPORTER", "")
+		tp, shutdown, err := NewTracerProvider(context.Background(), Config{})
+		assert.NoError(t, err)
+		assert.IsType(t, noop.TracerProvider{}, tp)
+		assert.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("stdout exporter writes to writer", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		tp, shutdown, err := NewTracerProvider(context.Background(), Config{
+			Exporter:    ExporterStdout,
+			Writer:      out,
+			ServiceName: "test-consumer",
+		})
+		assert.NoError(t, err)
+
+		_, span := tp.Tracer("test").Start(context.Background(), "processRecords")
+		span.End()
+		assert.NoError(t, shutdown(context.Background()))
+		assert.Contains(t, out.String(), `"Name":"processRecords"`)
+		assert.Contains(t, out.String(), "test-consumer")
+	})
+
+	t.Run("reads exporter from environment", func(t *testing.T) {
+		t.Setenv("OTEL_TRACES_EXPORTER", "zipkin")
+		_, _, err := NewTracerProvider(context.Background(), Config{})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,140 @@
+package kcl
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	producerTraceId   = "4bf92f3577b34da6a3ce929d0e0e4736"
+	producerParent    = "00-" + producerTraceId + "-00f067aa0ba902b7-01"
+	otherProducerId   = "0af7651916cd43dd8448eb211c80319c"
+	otherProducerPrnt = "00-" + otherProducerId + "-b7ad6b7169203331-01"
+)
+
+func spansByName(spans tracetest.SpanStubs) map[string][]tracetest.SpanStub {
+	byName := make(map[string][]tracetest.SpanStub)
+	for _, s := range spans {
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+	return byName
+}
+
+func spanAttr(s tracetest.SpanStub, key string) attribute.Value {
+	for _, kv := range s.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracing(t *testing.T) {
+	t.Run("creates action, checkpoint and record spans", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		rp := &RecordProcessorFuncs{
+			ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+				return cp.CheckpointBatch()
+			},
+		}
+		mockReader := bytes.NewBufferString(checkpointAck)
+		manager := NewManager(mockReader, &bytes.Buffer{}, rp,
+			WithTracerProvider(tp),
+			WithRecordTracing(JSONFieldCarrier("headers")),
+		)
+		manager.shardId = "shard-123"
+
+		batch := actions.ProcessAction{
+			Action:             actions.PROCESS_RECORDS,
+			MillisBehindLatest: 42,
+			Records: []actions.Record{
+				jsonRecord("1", "a", map[string]any{"headers": map[string]any{"traceparent": producerParent}}),
+				jsonRecord("2", "b", map[string]any{"headers": map[string]any{"Traceparent": otherProducerPrnt}}),
+				jsonRecord("3", "c", map[string]any{"no": "trace"}),
+			},
+		}
+		actionBytes, _ := json.Marshal(batch)
+		rAction, err := actions.NewRawAction(string(actionBytes))
+		assert.NoError(t, err)
+		assert.NoError(t, manager.processRawAction(rAction))
+
+		spans := spansByName(exporter.GetSpans())
+		if !assert.Len(t, spans["processRecords"], 1) {
+			return
+		}
+		action := spans["processRecords"][0]
+		assert.Equal(t, "shard-123", spanAttr(action, "kcl.shard_id").AsString())
+		assert.Equal(t, int64(3), spanAttr(action, "kcl.record_count").AsInt64())
+		assert.Equal(t, "1", spanAttr(action, "kcl.first_sequence_number").AsString())
+		assert.Equal(t, "3", spanAttr(action, "kcl.last_sequence_number").AsString())
+		assert.Equal(t, int64(42), spanAttr(action, "kcl.millis_behind_latest").AsInt64())
+
+		if assert.Len(t, spans["checkpoint"], 1) {
+			assert.Equal(t, action.SpanContext.SpanID(), spans["checkpoint"][0].Parent.SpanID())
+		}
+
+		records := spans["record"]
+		if assert.Len(t, records, 3) {
+			for _, r := range records {
+				assert.Equal(t, action.SpanContext.SpanID(), r.Parent.SpanID())
+			}
+			if assert.Len(t, records[0].Links, 1) {
+				assert.Equal(t, producerTraceId, records[0].Links[0].SpanContext.TraceID().String())
+			}
+			if assert.Len(t, records[1].Links, 1) {
+				assert.Equal(t, otherProducerId, records[1].Links[0].SpanContext.TraceID().String())
+			}
+			assert.Empty(t, records[2].Links)
+		}
+	})
+
+	t.Run("does not parent spans to finished action", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, new(MockRecordProcessor), WithTracerProvider(tp))
+
+		rAction, err := actions.NewRawAction(`{"action":"leaseLost"}`)
+		assert.NoError(t, err)
+		assert.NoError(t, manager.processRawAction(rAction))
+		manager.traceCheckpoint(checkpoint.Observation{})
+
+		spans := spansByName(exporter.GetSpans())
+		if assert.Len(t, spans["checkpoint"], 1) {
+			assert.False(t, spans["checkpoint"][0].Parent.IsValid())
+		}
+	})
+
+	t.Run("reads traceparent string field", func(t *testing.T) {
+		carrier := JSONFieldCarrier("meta.traceparent")(jsonRecord("1", "a", map[string]any{"meta": map[string]any{"traceparent": producerParent}}))
+		assert.Equal(t, producerParent, carrier.Get("traceparent"))
+		assert.Nil(t, JSONFieldCarrier("traceparent")(actions.Record{Data: "bm90IGpzb24="}))
+	})
+
+	t.Run("marks failed action span", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		mockProcessor := new(MockRecordProcessor)
+		mockProcessor.LeaseLostError = assert.AnError
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, mockProcessor, WithTracerProvider(tp))
+
+		rAction, err := actions.NewRawAction(`{"action":"leaseLost"}`)
+		assert.NoError(t, err)
+		assert.Error(t, manager.processRawAction(rAction))
+
+		spans := exporter.GetSpans()
+		if assert.Len(t, spans, 1) {
+			assert.Equal(t, actions.LEASE_LOST, spans[0].Name)
+			assert.Equal(t, codes.Error, spans[0].Status.Code)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package kcl
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"time"
+)
+
+// DefaultWatchdogExitCode is the exit code used when the watchdog
+// terminates the process and WatchdogPolicy.ExitCode is not set. It is
+// distinct from the exit code of a panic (2) or of Start returning an
+// error in the samples (1) so a stall is easy to spot.
+const DefaultWatchdogExitCode = 124
+
+// ErrStalled is the cause of a call's context once it ran past the
+// watchdog deadline, see context.Cause.
+var ErrStalled = errors.New("record processor call exceeded watchdog deadline")
+
+// WatchdogPolicy configures the watchdog timing every RecordProcessor
+// call, see WithWatchdog.
+type WatchdogPolicy struct {
+	// Deadline is how long a single RecordProcessor call may run
+	Deadline time.Duration
+	// Exit terminates the process once a call ran past Deadline, so
+	// KCL notices the child is gone and the lease is reassigned rather
+	// than left on a hung worker.
+	Exit bool
+	// ExitCode is the exit code used when Exit is set. It defaults to
+	// DefaultWatchdogExitCode.
+	ExitCode int
+}
+
+// ContextSetter is implemented by RecordProcessors that want the
+// context of the current call. SetContext is called before every
+// lifecycle call. The context is cancelled when the call returns, or
+// with ErrStalled as its cause once the watchdog deadline is exceeded.
+type ContextSetter interface {
+	SetContext(ctx context.Context)
+}
+
+// WithWatchdog times every RecordProcessor call against p.Deadline.
+// When a call runs past it, the watchdog logs a dump of every
+// goroutine, counts the stall in the metrics, cancels the call's
+// context (see ContextSetter and Call.Context) and, if p.Exit is set,
+// exits the process. Cancelling only helps processors that respect the
+// context, the watchdog cannot stop a call that ignores it.
+func WithWatchdog(p WatchdogPolicy) ManagerOpts {
+	return func(kclm *Manager) {
+		if p.ExitCode == 0 {
+			p.ExitCode = DefaultWatchdogExitCode
+		}
+		kclm.watchdog = &p
+	}
+}
+
+// watch returns the context for a call into the RecordProcessor for
+// actionType, along with the function to call once it returns.
+func (kclm *Manager) watch(actionType string) (context.Context, func()) {
+	parent := kclm.actionCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancelCause(parent)
+	if kclm.watchdog == nil {
+		return ctx, func() { cancel(nil) }
+	}
+
+	// captured here since the timer fires on another goroutine
+	loggr := kclm.loggr
+	shardId := kclm.shardId
+	p := *kclm.watchdog
+	start := time.Now()
+	timer := time.AfterFunc(p.Deadline, func() {
+		loggr.Error("record processor call exceeded watchdog deadline",
+			"deadline", p.Deadline,
+			"running_for", time.Since(start),
+			"goroutines", string(goroutineDump()),
+		)
+		kclm.metrics.observeStall(shardId, actionType)
+		cancel(ErrStalled)
+		if p.Exit {
+			loggr.Error("watchdog terminating worker", "exit_code", p.ExitCode)
+			kclm.exit(p.ExitCode)
+		}
+	})
+	return ctx, func() {
+		timer.Stop()
+		cancel(nil)
+	}
+}
+
+// goroutineDump returns the stack traces of every goroutine.
+func goroutineDump() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 64<<20 {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,91 @@
+package kcl
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer is a bytes.Buffer safe to log to from the watchdog's
+// timer goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatchdog(t *testing.T) {
+	t.Run("cancels stalled call and exits", func(t *testing.T) {
+		logs := &syncBuffer{}
+		var cause error
+		rp := &RecordProcessorFuncs{}
+		rp.ProcessRecordsFunc = func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+			// a hung call that at least respects its context
+			<-rp.Context().Done()
+			cause = context.Cause(rp.Context())
+			return cause
+		}
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, rp,
+			WithManagerLogger(slog.New(slog.NewTextHandler(logs, nil))),
+			WithMetrics("127.0.0.1:0"),
+			WithWatchdog(WatchdogPolicy{Deadline: 20 * time.Millisecond, Exit: true}),
+		)
+		manager.shardId = "shard-123"
+		exitCode := make(chan int, 1)
+		manager.exit = func(code int) { exitCode <- code }
+
+		err := manager.processRawAction(rawAction(t, testProcessAction("1")))
+		assert.ErrorIs(t, err, ErrStalled)
+		assert.ErrorIs(t, cause, ErrStalled)
+		select {
+		case code := <-exitCode:
+			assert.Equal(t, DefaultWatchdogExitCode, code)
+		case <-time.After(time.Second):
+			t.Fatal("watchdog did not exit")
+		}
+		assert.Contains(t, logs.String(), "exceeded watchdog deadline")
+		assert.Contains(t, logs.String(), "goroutine ")
+		assert.Contains(t, scrapeMetrics(t, manager.MetricsHandler()), `kcl_watchdog_stalls_total{action="processRecords",shard_id="shard-123"} 1`)
+	})
+
+	t.Run("leaves calls within deadline alone", func(t *testing.T) {
+		var ctx context.Context
+		rp := &RecordProcessorFuncs{}
+		rp.ProcessRecordsFunc = func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+			ctx = rp.Context()
+			return ctx.Err()
+		}
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, rp,
+			WithWatchdog(WatchdogPolicy{Deadline: time.Minute, Exit: true}),
+		)
+		manager.exit = func(code int) { t.Errorf("unexpected exit with code %d", code) }
+
+		assert.NoError(t, manager.processRawAction(rawAction(t, testProcessAction("1"))))
+		// the context does not outlive the call
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+		assert.NotErrorIs(t, context.Cause(ctx), ErrStalled)
+	})
+
+	t.Run("uses configured exit code", func(t *testing.T) {
+		manager := NewManager(&bytes.Buffer{}, &bytes.Buffer{}, new(MockRecordProcessor), WithWatchdog(WatchdogPolicy{Deadline: time.Second, ExitCode: 3}))
+		assert.Equal(t, 3, manager.watchdog.ExitCode)
+	})
+}
@@ -0,0 +1,317 @@
+// Package wiretap records the json messages exchanged with the KCL
+// Multilang process, for debugging protocol issues without writing
+// anything to stdout (which would corrupt the protocol).
+//
+// Sessions are recorded as NDJSON, one Entry per line, and can be read
+// back with ReadEntries to replay them in tests.
+package wiretap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Direction is which way a message travelled.
+type Direction string
+
+const (
+	// In is a message sent by the KCL Multilang process to the child
+	In Direction = "in"
+	// Out is a message sent by the child to the KCL Multilang process
+	Out Direction = "out"
+)
+
+// Entry is a single recorded message.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Direction Direction `json:"direction"`
+	// Message is the message as it was sent. Lines that were not valid
+	// json are recorded as a json string.
+	Message json.RawMessage `json:"message"`
+}
+
+// Recorder writes Entries to an io.Writer or a rotated file. It is safe
+// for concurrent use. Failing to record never fails the tapped stream,
+// instead the first error is kept and reported by Err.
+type Recorder struct {
+	mu     sync.Mutex
+	w      io.Writer
+	redact bool
+
+	// set when recording to a file
+	path       string
+	file       *os.File
+	size       int64
+	maxBytes   int64
+	maxBackups int
+
+	err error
+}
+
+type RecorderOpts func(r *Recorder)
+
+// NewRecorder records entries to w.
+func NewRecorder(w io.Writer, opts ...RecorderOpts) *Recorder {
+	r := &Recorder{w: w}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// OpenRecorder records entries to the file at path, appending to it if
+// it already exists.
+func OpenRecorder(path string, opts ...RecorderOpts) (*Recorder, error) {
+	r := &Recorder{path: path, maxBackups: 3}
+	for _, opt := range opts {
+		opt(r)
+	}
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// WithRedaction replaces the data of every record with an empty string
+// so record contents never end up in the recording.
+func WithRedaction() RecorderOpts {
+	return func(r *Recorder) {
+		r.redact = true
+	}
+}
+
+// WithRotation rotates the recording file once writing an entry would
+// take it past maxBytes. The file at path is renamed to path.1, path.1
+// to path.2 and so on, keeping at most maxBackups old files. It only
+// applies to recorders created with OpenRecorder.
+func WithRotation(maxBytes int64, maxBackups int) RecorderOpts {
+	return func(r *Recorder) {
+		r.maxBytes = maxBytes
+		r.maxBackups = maxBackups
+	}
+}
+
+func (r *Recorder) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening wire tap file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error opening wire tap file: %w", err)
+	}
+	r.file = f
+	r.w = f
+	r.size = info.Size()
+	return nil
+}
+
+func (r *Recorder) rotate() error {
+	err := r.file.Close()
+	if err != nil {
+		return err
+	}
+	if r.maxBackups < 1 {
+		err = os.Remove(r.path)
+	} else {
+		for i := r.maxBackups - 1; i >= 1; i-- {
+			err = os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		err = os.Rename(r.path, r.path+".1")
+	}
+	if err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// Record records a single message line travelling in direction dir.
+func (r *Recorder) Record(dir Direction, line []byte) {
+	e := Entry{Time: time.Now(), Direction: dir}
+	line = bytes.TrimSpace(line)
+	switch {
+	case !json.Valid(line):
+		e.Message, _ = json.Marshal(string(line))
+	case r.redact:
+		e.Message = redact(line)
+	default:
+		e.Message = append(json.RawMessage(nil), line...)
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		r.setErr(err)
+		return
+	}
+	b = append(b, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil && r.maxBytes > 0 && r.size > 0 && r.size+int64(len(b)) > r.maxBytes {
+		err = r.rotate()
+		if err != nil {
+			r.keepErr(fmt.Errorf("error rotating wire tap file: %w", err))
+			return
+		}
+	}
+	n, err := r.w.Write(b)
+	r.size += int64(n)
+	if err != nil {
+		r.keepErr(fmt.Errorf("error writing wire tap entry: %w", err))
+	}
+}
+
+func (r *Recorder) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keepErr(err)
+}
+
+func (r *Recorder) keepErr(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// Err returns the first error the recorder ran into, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close closes the recording file of recorders created with
+// OpenRecorder. It does nothing otherwise.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// redact blanks the data of every record in a processRecords message.
+// Any other message is returned as is.
+func redact(line []byte) json.RawMessage {
+	var msg map[string]json.RawMessage
+	err := json.Unmarshal(line, &msg)
+	if err != nil || msg["records"] == nil {
+		return append(json.RawMessage(nil), line...)
+	}
+	var records []map[string]json.RawMessage
+	err = json.Unmarshal(msg["records"], &records)
+	if err != nil {
+		return append(json.RawMessage(nil), line...)
+	}
+	for _, rec := range records {
+		if _, ok := rec["data"]; ok {
+			rec["data"] = json.RawMessage(`""`)
+		}
+	}
+	msg["records"], _ = json.Marshal(records)
+	b, _ := json.Marshal(msg)
+	return b
+}
+
+// Reader returns a reader recording every line read from r as a
+// message in direction dir.
+func (r *Recorder) Reader(rd io.Reader, dir Direction) io.Reader {
+	return &tapReader{r: rd, lines: lineTap{rec: r, dir: dir}}
+}
+
+// Writer returns a writer recording every line written to w as a
+// message in direction dir.
+func (r *Recorder) Writer(w io.Writer, dir Direction) io.Writer {
+	return &tapWriter{w: w, lines: lineTap{rec: r, dir: dir}}
+}
+
+// lineTap splits a byte stream into lines and records each of them.
+type lineTap struct {
+	rec *Recorder
+	dir Direction
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *lineTap) feed(p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	for {
+		i := bytes.IndexByte(t.buf, '\n')
+		if i < 0 {
+			return
+		}
+		if line := t.buf[:i]; len(bytes.TrimSpace(line)) > 0 {
+			t.rec.Record(t.dir, line)
+		}
+		t.buf = t.buf[i+1:]
+	}
+}
+
+// flush records what is left of an unterminated last line.
+func (t *lineTap) flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(bytes.TrimSpace(t.buf)) > 0 {
+		t.rec.Record(t.dir, t.buf)
+	}
+	t.buf = nil
+}
+
+type tapReader struct {
+	r     io.Reader
+	lines lineTap
+}
+
+func (t *tapReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.lines.feed(p[:n])
+	if err == io.EOF {
+		t.lines.flush()
+	}
+	return n, err
+}
+
+type tapWriter struct {
+	w     io.Writer
+	lines lineTap
+}
+
+func (t *tapWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.lines.feed(p[:n])
+	return n, err
+}
+
+// ReadEntries reads back a recording made by a Recorder. When a file
+// was rotated, read the backups from the highest number down before the
+// current file to get the entries in order.
+func ReadEntries(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e Entry
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			return entries, fmt.Errorf("error reading wire tap entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
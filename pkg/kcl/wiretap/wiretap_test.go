@@ -0,0 +1,87 @@
+package wiretap
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Run("records lines read and written", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		rec := NewRecorder(out)
+
+		r := rec.Reader(strings.NewReader("{\"action\":\"initialize\"}\n{\"action\":\"leaseL"), In)
+		_, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		w := rec.Writer(io.Discard, Out)
+		_, err = w.Write([]byte("{\"action\":\"status\","))
+		assert.NoError(t, err)
+		_, err = w.Write([]byte("\"responseFor\":\"initialize\"}\nnot json\n"))
+		assert.NoError(t, err)
+
+		entries, err := ReadEntries(out)
+		assert.NoError(t, err)
+		if assert.Len(t, entries, 4) {
+			assert.Equal(t, In, entries[0].Direction)
+			assert.JSONEq(t, `{"action":"initialize"}`, string(entries[0].Message))
+			assert.False(t, entries[0].Time.IsZero())
+			// the unterminated last line is recorded at EOF
+			assert.JSONEq(t, `"{\"action\":\"leaseL"`, string(entries[1].Message))
+			assert.Equal(t, Out, entries[2].Direction)
+			assert.JSONEq(t, `{"action":"status","responseFor":"initialize"}`, string(entries[2].Message))
+			assert.JSONEq(t, `"not json"`, string(entries[3].Message))
+		}
+		assert.NoError(t, rec.Err())
+	})
+
+	t.Run("redacts record data", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		rec := NewRecorder(out, WithRedaction())
+		rec.Record(In, []byte(`{"action":"processRecords","records":[{"data":"c2VjcmV0","sequenceNumber":"1"}]}`))
+		rec.Record(In, []byte(`{"action":"shardEnded"}`))
+
+		entries, err := ReadEntries(out)
+		assert.NoError(t, err)
+		if assert.Len(t, entries, 2) {
+			assert.JSONEq(t, `{"action":"processRecords","records":[{"data":"","sequenceNumber":"1"}]}`, string(entries[0].Message))
+			assert.JSONEq(t, `{"action":"shardEnded"}`, string(entries[1].Message))
+		}
+	})
+
+	t.Run("rotates file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "session.ndjson")
+		rec, err := OpenRecorder(path, WithRotation(150, 2))
+		assert.NoError(t, err)
+		for _, action := range []string{"initialize", "processRecords", "shardEnded", "shutdownRequested"} {
+			rec.Record(In, []byte(`{"action":"`+action+`"}`))
+		}
+		assert.NoError(t, rec.Close())
+		assert.NoError(t, rec.Err())
+
+		var all []Entry
+		for _, p := range []string{path + ".2", path + ".1", path} {
+			f, err := os.Open(p)
+			if !assert.NoError(t, err) {
+				return
+			}
+			entries, err := ReadEntries(f)
+			f.Close()
+			assert.NoError(t, err)
+			assert.NotEmpty(t, entries)
+			all = append(all, entries...)
+		}
+		_, err = os.Stat(path + ".3")
+		assert.True(t, os.IsNotExist(err))
+		// the oldest entry was rotated away
+		if assert.Len(t, all, 3) {
+			assert.JSONEq(t, `{"action":"processRecords"}`, string(all[0].Message))
+			assert.JSONEq(t, `{"action":"shutdownRequested"}`, string(all[2].Message))
+		}
+	})
+}
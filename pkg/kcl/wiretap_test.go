@@ -0,0 +1,56 @@
+package kcl
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/actions"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/checkpoint"
+	"github.com/charliemenke/amazon-kinesis-client-golang/pkg/kcl/wiretap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManagerWireTap(t *testing.T) {
+	rp := &RecordProcessorFuncs{
+		ProcessRecordsFunc: func(records []actions.Record, lag int, cp *checkpoint.Checkpointer) error {
+			return cp.CheckpointBatch()
+		},
+	}
+	sent := []string{
+		`{"action":"initialize","shardId":"shard-123"}`,
+		`{"action":"processRecords","records":[{"data":"ZGF0YQ==","sequenceNumber":"1"}]}`,
+		checkpointAck,
+		`{"action":"leaseLost"}`,
+	}
+	tap := &bytes.Buffer{}
+	output := &bytes.Buffer{}
+	manager := NewManager(strings.NewReader(strings.Join(sent, "\n")+"\n"), output, rp,
+		WithManagerWireTap(wiretap.NewRecorder(tap)),
+		WithManagerLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, manager.Start())
+
+	entries, err := wiretap.ReadEntries(tap)
+	assert.NoError(t, err)
+	var in, out []string
+	for _, e := range entries {
+		if e.Direction == wiretap.In {
+			in = append(in, string(e.Message))
+		} else {
+			out = append(out, string(e.Message))
+		}
+	}
+	// the actions read and the checkpoint round trip are recorded along
+	// with the status responses, without changing what was sent
+	assert.Equal(t, sent, in)
+	assert.Equal(t, []string{
+		`{"action":"status","responseFor":"initialize"}`,
+		`{"action":"checkpoint"}`,
+		`{"action":"status","responseFor":"processRecords"}`,
+		`{"action":"status","responseFor":"leaseLost"}`,
+	}, out)
+	assert.Equal(t, strings.Join(out, "\n")+"\n", output.String())
+}